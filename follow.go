@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+)
+
+// followPoll is the interval of checking the followed files for new lines and rotations.
+const followPoll = time.Second
+
+// followProcess analyzes the log files and the lines appended to them like `tail -F`, and
+// re-renders the output every interval, or on the render signals, until it is interrupted.
+func followProcess(logFiles []string, loganalyzer *loganalyzer) {
+	var (
+		done      = make(chan struct{})
+		followers sync.WaitGroup
+		streams   sync.WaitGroup
+	)
+	for _, group := range rotationGroups(logFiles) {
+		// the rotated members are read to the end in order, then the live file is followed
+		members, live := group, ""
+		if last := group[len(group)-1]; last != ioutil.Stdin && !ioutil.IsURL(last) && ioutil.RotationName(last) == last {
+			members, live = group[:len(group)-1], last
+		}
+		if live == "" {
+			// streams are read to the end, which can not be stopped by done
+			streams.Add(1)
+			go func() {
+				defer streams.Done()
+				followGroup(loganalyzer, members, "", done)
+			}()
+			continue
+		}
+		followers.Add(1)
+		go func() {
+			defer followers.Done()
+			followGroup(loganalyzer, members, live, done)
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		followers.Wait()
+		streams.Wait()
+		close(finished)
+	}()
+
+	var ticker <-chan time.Time
+	if followInterval > 0 {
+		t := time.NewTicker(time.Duration(followInterval) * time.Second)
+		defer t.Stop()
+		ticker = t.C
+	}
+	render := make(chan os.Signal, 1)
+	if len(renderSignals) > 0 {
+		signal.Notify(render, renderSignals...)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-ticker:
+			renderOutput(loganalyzer)
+		case <-render:
+			renderOutput(loganalyzer)
+		case <-interrupt:
+			close(done)
+			followers.Wait()
+			renderOutput(loganalyzer)
+			closeLogAnalyzer(loganalyzer)
+			return
+		case <-finished:
+			renderOutput(loganalyzer)
+			closeLogAnalyzer(loganalyzer)
+			return
+		}
+	}
+}
+
+// followGroup reads the rotated members of a log to the end in order, then follows the live
+// file until done is closed, if the log has a live file.
+func followGroup(loganalyzer *loganalyzer, members []string, live string, done <-chan struct{}) {
+	for _, member := range members {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		followStream(loganalyzer, member)
+	}
+	if live != "" {
+		followLog(loganalyzer, live, done)
+	}
+}
+
+func followLog(loganalyzer *loganalyzer, logFile string, done <-chan struct{}) {
+	logParser := loganalyzer.parserOf(logFile)
+	if logParser == nil {
+		file := ioutil.OpenFile(logFile)
+		reader, err := ioutil.ReadFile(file)
+		if err != nil {
+			ioutil.Fatal("read file error: %v\n", err.Error())
+			return
+		}
+		logParser = detectLogParser(logFile, reader)
+		_ = file.Close()
+	}
+	stateful, isStateful := logParser.(parser.StatefulParser)
+	if isStateful {
+		stateful.Reset()
+	}
+
+	var (
+		lineNo int
+		offset int64
+	)
+	follower := ioutil.NewFollower(logFile, followPoll)
+	err := follower.Follow(done, func(line []byte) {
+		// lines are parsed in order, the appended lines are not too many
+		lineNo++
+		parseLog(loganalyzer, logParser, logFile, lineNo, offset, line)
+		offset += int64(len(line))
+	}, func() {
+		_, _ = fmt.Fprintf(os.Stderr, "follow %v: file rotated or truncated\n", logFile)
+		lineNo, offset = 0, 0
+		if isStateful {
+			stateful.Reset()
+		}
+	})
+	if err != nil {
+		ioutil.Fatal("follow %v error: %v\n", logFile, err.Error())
+	}
+}
+
+// followStream reads the log file to the end once, e.g. the standard input, a URL or a rotated
+// member of a log.
+func followStream(loganalyzer *loganalyzer, logFile string) {
+	logParser := loganalyzer.parserOf(logFile)
+	body := openLog(logFile)
+	if logFile != ioutil.Stdin {
+		defer body.Close()
+	}
+	reader, err := ioutil.ReadFile(body)
+	if err != nil {
+		ioutil.Fatal("read file error: %v\n", err.Error())
+		return
+	}
+	if logParser == nil {
+		logParser = detectLogParser(logFile, reader)
+	}
+	if stateful, ok := logParser.(parser.StatefulParser); ok {
+		stateful.Reset()
+	}
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			parseLog(loganalyzer, logParser, logFile, lineNo, offset, data)
+			offset += int64(len(data))
+		}
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			ioutil.Fatal("read file error: %v\n", err.Error())
+			return
+		}
+	}
+}
+
+func renderOutput(loganalyzer *loganalyzer) {
+	fmt.Printf("==> %v <==\n", time.Now().Format(time.RFC3339))
+	loganalyzer.handler.Output(limit)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fantasticmao/nginx-log-analyzer/handler"
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.log")
+	writeLog(t, file, 10, 0)
+	loganalyzer := &loganalyzer{
+		parser:   parser.NewCombinedParser(),
+		handler:  handler.NewPvAndUvHandler(),
+		rejecter: newRejecter(onErrorFail, ""),
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		followLog(loganalyzer, file, done)
+	}()
+	pvIs := func(pv int) func() bool {
+		return func() bool { return pvOf(t, loganalyzer.handler) == pv }
+	}
+	assert.Eventually(t, pvIs(10), 5*time.Second, 10*time.Millisecond)
+
+	appendLog(t, file, 10, 5)
+	assert.Eventually(t, pvIs(15), 5*time.Second, 10*time.Millisecond)
+
+	// the rotated file is read to the end, and the new file is re-opened
+	appendLog(t, file, 15, 2)
+	assert.Nil(t, os.Rename(file, file+".1"))
+	appendLog(t, file, 17, 3)
+	assert.Eventually(t, pvIs(20), 5*time.Second, 10*time.Millisecond)
+
+	close(done)
+	<-stopped
+}
+
+func TestFollowGroup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log")
+	writeLog(t, file+".1", 10, 0)
+	appendLog(t, file, 10, 5)
+	loganalyzer := &loganalyzer{
+		parser:   parser.NewCombinedParser(),
+		handler:  handler.NewPvAndUvHandler(),
+		rejecter: newRejecter(onErrorFail, ""),
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		followGroup(loganalyzer, []string{file + ".1"}, file, done)
+	}()
+	pvIs := func(pv int) func() bool {
+		return func() bool { return pvOf(t, loganalyzer.handler) == pv }
+	}
+	// the rotated member is read once, and the live file is followed
+	assert.Eventually(t, pvIs(15), 5*time.Second, 10*time.Millisecond)
+	appendLog(t, file+".1", 15, 2)
+	appendLog(t, file, 17, 3)
+	assert.Eventually(t, pvIs(18), 5*time.Second, 10*time.Millisecond)
+	close(done)
+	<-stopped
+	assert.Equal(t, 18, pvOf(t, loganalyzer.handler))
+
+	// the rotated members without the live file are read to the end only
+	loganalyzer.handler = handler.NewPvAndUvHandler()
+	followGroup(loganalyzer, []string{file + ".1"}, "", make(chan struct{}))
+	assert.Equal(t, 12, pvOf(t, loganalyzer.handler))
+}
@@ -1,10 +1,12 @@
 module github.com/fantasticmao/nginx-log-analyzer
 
-go 1.21.3
+go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/oschwald/geoip2-golang v1.9.0
 	github.com/stretchr/testify v1.8.4
+	github.com/ulikunitz/xz v0.5.15
 )
 
 require (
@@ -16,7 +16,7 @@ func ExampleNewPvAndUvHandler() {
 	// UV: 3
 }
 
-func ExampleNewMostVisitedIpsHandler() {
+func ExampleNewMostVisitedFieldsHandler_ips() {
 	handler := NewMostVisitedFieldsHandler(AnalysisTypeVisitedIps)
 	handler.Input(&parser.LogInfo{RemoteAddr: ip1})
 	handler.Input(&parser.LogInfo{RemoteAddr: ip1})
@@ -31,7 +31,7 @@ func ExampleNewMostVisitedIpsHandler() {
 	// "192.168.1.3" hits: 1
 }
 
-func ExampleNewMostVisitedUrisHandler() {
+func ExampleNewMostVisitedFieldsHandler_uris() {
 	handler := NewMostVisitedFieldsHandler(AnalysisTypeVisitedUris)
 	handler.Input(&parser.LogInfo{Request: uri1})
 	handler.Input(&parser.LogInfo{Request: uri1})
@@ -46,7 +46,7 @@ func ExampleNewMostVisitedUrisHandler() {
 	// "GET /name/Bob HTTP/2.0" hits: 1
 }
 
-func ExampleNewMostVisitedUserAgentsHandler() {
+func ExampleNewMostVisitedFieldsHandler_userAgents() {
 	handler := NewMostVisitedFieldsHandler(AnalysisTypeVisitedUserAgents)
 	handler.Input(&parser.LogInfo{HttpUserAgent: userAgent1})
 	handler.Input(&parser.LogInfo{HttpUserAgent: userAgent1})
@@ -72,6 +72,7 @@ func ExampleNewMostVisitedLocationsHandler() {
 	handler.Input(&parser.LogInfo{RemoteAddr: "2.125.160.216"})
 	handler.Input(&parser.LogInfo{RemoteAddr: "2001:218::"}) // Japan -> unknown
 	handler.Output(limit)
+	_ = handler.Close()
 
 }
 
@@ -128,3 +129,23 @@ func ExampleNewLargestPercentTimeUrisHandler() {
 	// "GET /name/Sam HTTP/2.0" P30.00 response-time: 0.200
 	// "GET /name/Tom HTTP/2.0" P30.00 response-time: 0.100
 }
+
+func ExampleNewMostFrequentErrorsHandler() {
+	handler := NewMostFrequentErrorsHandler()
+	handler.Input(&parser.LogInfo{Path: "/api", UpstreamAddr: "10.0.0.1:80", Fields: map[string]string{"level": "error", "message": "upstream timed out (110: Connection timed out)"}})
+	handler.Input(&parser.LogInfo{Path: "/api", UpstreamAddr: "10.0.0.2:80", Fields: map[string]string{"level": "error", "message": "upstream timed out (110: Connection timed out)"}})
+	handler.Input(&parser.LogInfo{Fields: map[string]string{"level": "warn", "message": "conflicting server name \"a.com\" on 0.0.0.0:80, ignored"}})
+	handler.Output(limit)
+	// Output:
+	// levels:
+	//   |--"error" hits: 2
+	//   |--"warn" hits: 1
+	// messages:
+	//   |--"[error] upstream timed out (N: Connection timed out)" hits: 2
+	//   |--"[warn] conflicting server name "*" on N, ignored" hits: 1
+	// upstreams:
+	//   |--"10.0.0.1:80" hits: 1
+	//   |--"10.0.0.2:80" hits: 1
+	// uris:
+	//   |--"/api" hits: 2
+}
@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
 	"github.com/fantasticmao/nginx-log-analyzer/parser"
 )
 
@@ -13,6 +17,7 @@ const (
 	AnalysisTypeResponseStatus
 	AnalysisTypeAverageTimeUris
 	AnalysisTypePercentTimeUris
+	AnalysisTypeErrors
 )
 
 type Handler interface {
@@ -20,3 +25,49 @@ type Handler interface {
 
 	Output(limit int)
 }
+
+// BatchHandler is a Handler which inputs a batch of LogInfo at a time, the lock is taken once
+// for the batch rather than for each LogInfo.
+type BatchHandler interface {
+	Handler
+
+	InputBatch(infos []*parser.LogInfo)
+}
+
+// StatefulHandler is a Handler whose state can be saved and loaded, so that the analysis can
+// be continued by the following runs in the '-incremental' mode.
+type StatefulHandler interface {
+	Handler
+
+	// SaveState writes the state as JSON.
+	SaveState(w io.Writer) error
+
+	// LoadState merges the saved state into the handler.
+	LoadState(r io.Reader) error
+}
+
+func encodeState(w io.Writer, state any) error {
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		return fmt.Errorf("encode state error: %v", err.Error())
+	}
+	return nil
+}
+
+func decodeState(r io.Reader, state any) error {
+	if err := json.NewDecoder(r).Decode(state); err != nil {
+		return fmt.Errorf("decode state error: %v", err.Error())
+	}
+	return nil
+}
+
+func mergeCounts[K comparable](dst, src map[K]int) {
+	for k, count := range src {
+		dst[k] += count
+	}
+}
+
+func mergeTimeCosts(dst, src map[string][]float64) {
+	for uri, costList := range src {
+		dst[uri] = append(dst[uri], costList...)
+	}
+}
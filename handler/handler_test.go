@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/fantasticmao/nginx-log-analyzer/parser"
@@ -160,3 +161,105 @@ func TestNewLargestPercentTimeUrisHandler(t *testing.T) {
 	assert.Equal(t, []float64{responseTime2, responseTime3}, handler.timeCostListMap[uri2])
 	assert.Equal(t, []float64{responseTime3}, handler.timeCostListMap[uri3])
 }
+
+func TestMostVisitedUrisHandlerSplitRequest(t *testing.T) {
+	handler := NewMostVisitedFieldsHandler(AnalysisTypeVisitedUris)
+	handler.Input(&parser.LogInfo{Request: "GET /name/Tom?a=1 HTTP/2.0", Method: "GET", Path: "/name/Tom", Query: "a=1"})
+	handler.Input(&parser.LogInfo{Request: "HEAD /name/Tom HTTP/2.0", Method: "HEAD", Path: "/name/Tom"})
+	handler.Input(&parser.LogInfo{Request: "-", InvalidRequest: true})
+
+	assert.Equal(t, 2, handler.countMap["/name/Tom"])
+	assert.Equal(t, 1, handler.countMap["-"])
+}
+
+func TestNewMostFrequentErrorsHandler(t *testing.T) {
+	handler := NewMostFrequentErrorsHandler()
+	handler.Input(&parser.LogInfo{Path: "/a.png", Fields: map[string]string{"level": "error", "message": `open() "/var/www/a.png" failed (2: No such file or directory)`}})
+	handler.Input(&parser.LogInfo{Path: "/b.png", Fields: map[string]string{"level": "error", "message": `open() "/var/www/b.png" failed (2: No such file or directory)`}})
+	handler.Input(&parser.LogInfo{Path: "/api", UpstreamAddr: "10.0.0.1:80", Fields: map[string]string{"level": "error", "message": "connect() failed (111: Connection refused) while connecting to upstream"}})
+	handler.Input(&parser.LogInfo{Fields: map[string]string{"level": "alert", "message": "worker process 1234 exited on signal 11"}})
+
+	assert.Equal(t, 3, handler.levelCountMap["error"])
+	assert.Equal(t, 1, handler.levelCountMap["alert"])
+	assert.Equal(t, 2, handler.messageCountMap[`[error] open() "*" failed (N: No such file or directory)`])
+	assert.Equal(t, 1, handler.messageCountMap["[alert] worker process N exited on signal N"])
+	assert.Equal(t, 1, handler.upstreamCountMap["10.0.0.1:80"])
+	assert.Equal(t, 3, len(handler.uriCountMap))
+}
+
+func TestHandlerState(t *testing.T) {
+	inputs := []*parser.LogInfo{
+		{RemoteAddr: ip1, Request: uri1, Status: responseStatus1, RequestTime: responseTime1},
+		{RemoteAddr: ip2, Request: uri2, Status: responseStatus2, RequestTime: responseTime2},
+		{RemoteAddr: ip2, Request: uri2, Status: responseStatus2, RequestTime: responseTime3,
+			Fields: map[string]string{"level": "error", "message": "worker process 1234 exited on signal 11"}},
+	}
+	for _, newHandler := range []func() StatefulHandler{
+		func() StatefulHandler { return NewPvAndUvHandler() },
+		func() StatefulHandler { return NewMostVisitedFieldsHandler(AnalysisTypeVisitedIps) },
+		func() StatefulHandler {
+			return NewMostVisitedLocationsHandler("../testdata/GeoLite2-City-Test.mmdb", limit)
+		},
+		func() StatefulHandler { return NewMostFrequentStatusHandler() },
+		func() StatefulHandler { return NewLargestAverageTimeUrisHandler() },
+		func() StatefulHandler { return NewLargestPercentTimeUrisHandler(50) },
+		func() StatefulHandler { return NewMostFrequentErrorsHandler() },
+	} {
+		// the state of the former inputs is loaded before the latter inputs, like the
+		// following runs of the incremental analysis
+		whole, former, latter := newHandler(), newHandler(), newHandler()
+		for _, info := range inputs {
+			whole.Input(info)
+		}
+		for _, info := range inputs[:2] {
+			former.Input(info)
+		}
+		var buf bytes.Buffer
+		assert.Nil(t, former.SaveState(&buf))
+		assert.Nil(t, latter.LoadState(&buf))
+		for _, info := range inputs[2:] {
+			latter.Input(info)
+		}
+
+		var expected, actual bytes.Buffer
+		assert.Nil(t, whole.SaveState(&expected))
+		assert.Nil(t, latter.SaveState(&actual))
+		assert.JSONEq(t, expected.String(), actual.String())
+	}
+
+	assert.NotNil(t, NewPvAndUvHandler().LoadState(bytes.NewReader([]byte("{"))))
+}
+
+func TestHandlerInputBatch(t *testing.T) {
+	inputs := []*parser.LogInfo{
+		{RemoteAddr: ip1, Request: uri1, Status: responseStatus1, RequestTime: responseTime1},
+		{RemoteAddr: ip2, Request: uri2, Status: responseStatus2, RequestTime: responseTime2},
+		{RemoteAddr: ip2, Request: uri2, Status: responseStatus2, RequestTime: responseTime3,
+			Fields: map[string]string{"level": "error", "message": "worker process 1234 exited on signal 11"}},
+	}
+	for _, newHandler := range []func() Handler{
+		func() Handler { return NewPvAndUvHandler() },
+		func() Handler { return NewMostVisitedFieldsHandler(AnalysisTypeVisitedIps) },
+		func() Handler {
+			return NewMostVisitedLocationsHandler("../testdata/GeoLite2-City-Test.mmdb", limit)
+		},
+		func() Handler { return NewMostFrequentStatusHandler() },
+		func() Handler { return NewLargestAverageTimeUrisHandler() },
+		func() Handler { return NewLargestPercentTimeUrisHandler(50) },
+		func() Handler { return NewMostFrequentErrorsHandler() },
+	} {
+		single, batch := newHandler(), newHandler()
+		for _, info := range inputs {
+			single.Input(info)
+		}
+		batchHandler, ok := batch.(BatchHandler)
+		assert.True(t, ok)
+		batchHandler.InputBatch(inputs[:1])
+		batchHandler.InputBatch(inputs[1:])
+
+		var expected, actual bytes.Buffer
+		assert.Nil(t, single.(StatefulHandler).SaveState(&expected))
+		assert.Nil(t, batch.(StatefulHandler).SaveState(&actual))
+		assert.JSONEq(t, expected.String(), actual.String())
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"sync"
 
@@ -22,15 +23,30 @@ func NewLargestAverageTimeUrisHandler() *LargestAverageTimeUrisHandler {
 func (handler *LargestAverageTimeUrisHandler) Input(info *parser.LogInfo) {
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
-	if _, ok := handler.timeCostListMap[info.Request]; ok {
-		handler.timeCostListMap[info.Request] = append(handler.timeCostListMap[info.Request], info.RequestTime)
+	handler.input(info)
+}
+
+func (handler *LargestAverageTimeUrisHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *LargestAverageTimeUrisHandler) input(info *parser.LogInfo) {
+	uri := info.Uri()
+	if _, ok := handler.timeCostListMap[uri]; ok {
+		handler.timeCostListMap[uri] = append(handler.timeCostListMap[uri], info.RequestTime)
 	} else {
 		array := []float64{info.RequestTime}
-		handler.timeCostListMap[info.Request] = array
+		handler.timeCostListMap[uri] = array
 	}
 }
 
 func (handler *LargestAverageTimeUrisHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	timeCostMap := make(map[string]float64)
 	for uri, costList := range handler.timeCostListMap {
 		var sum = 0.0
@@ -53,3 +69,20 @@ func (handler *LargestAverageTimeUrisHandler) Output(limit int) {
 		fmt.Printf("\"%v\" average response-time: %.3f\n", keys[i], timeCostMap[keys[i]])
 	}
 }
+
+func (handler *LargestAverageTimeUrisHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, handler.timeCostListMap)
+}
+
+func (handler *LargestAverageTimeUrisHandler) LoadState(r io.Reader) error {
+	var timeCostListMap map[string][]float64
+	if err := decodeState(r, &timeCostListMap); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeTimeCosts(handler.timeCostListMap, timeCostListMap)
+	return nil
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"sort"
 	"sync"
@@ -31,15 +32,30 @@ func NewLargestPercentTimeUrisHandler(percentile float64) *LargestPercentTimeUri
 func (handler *LargestPercentTimeUrisHandler) Input(info *parser.LogInfo) {
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
-	if _, ok := handler.timeCostListMap[info.Request]; ok {
-		handler.timeCostListMap[info.Request] = append(handler.timeCostListMap[info.Request], info.RequestTime)
+	handler.input(info)
+}
+
+func (handler *LargestPercentTimeUrisHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *LargestPercentTimeUrisHandler) input(info *parser.LogInfo) {
+	uri := info.Uri()
+	if _, ok := handler.timeCostListMap[uri]; ok {
+		handler.timeCostListMap[uri] = append(handler.timeCostListMap[uri], info.RequestTime)
 	} else {
 		array := []float64{info.RequestTime}
-		handler.timeCostListMap[info.Request] = array
+		handler.timeCostListMap[uri] = array
 	}
 }
 
 func (handler *LargestPercentTimeUrisHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	timeCostMap := make(map[string]float64)
 	for uri, costList := range handler.timeCostListMap {
 		sort.Float64s(costList)
@@ -62,3 +78,20 @@ func (handler *LargestPercentTimeUrisHandler) Output(limit int) {
 		fmt.Printf("\"%v\" P%.2f response-time: %.3f\n", keys[i], handler.percentile, timeCostMap[keys[i]])
 	}
 }
+
+func (handler *LargestPercentTimeUrisHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, handler.timeCostListMap)
+}
+
+func (handler *LargestPercentTimeUrisHandler) LoadState(r io.Reader) error {
+	var timeCostListMap map[string][]float64
+	if err := decodeState(r, &timeCostListMap); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeTimeCosts(handler.timeCostListMap, timeCostListMap)
+	return nil
+}
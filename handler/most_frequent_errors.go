@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+)
+
+var (
+	quotedRegex = regexp.MustCompile(`"[^"]*"`)
+	numberRegex = regexp.MustCompile(`\b\d+(?:[.:]\d+)*\b`)
+)
+
+type MostFrequentErrorsHandler struct {
+	// level -> count
+	levelCountMap map[string]int
+	// message template -> count
+	messageCountMap map[string]int
+	// upstream -> count
+	upstreamCountMap map[string]int
+	// uri -> count
+	uriCountMap map[string]int
+	mu          sync.Mutex // Mutex to synchronize map access
+}
+
+func NewMostFrequentErrorsHandler() *MostFrequentErrorsHandler {
+	return &MostFrequentErrorsHandler{
+		levelCountMap:    make(map[string]int),
+		messageCountMap:  make(map[string]int),
+		upstreamCountMap: make(map[string]int),
+		uriCountMap:      make(map[string]int),
+	}
+}
+
+func (handler *MostFrequentErrorsHandler) Input(info *parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	handler.input(info)
+}
+
+func (handler *MostFrequentErrorsHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *MostFrequentErrorsHandler) input(info *parser.LogInfo) {
+	level := info.Field("level")
+	message := fmt.Sprintf("[%v] %v", level, messageTemplate(info.Field("message")))
+	uri := info.Uri()
+	handler.levelCountMap[level]++
+	handler.messageCountMap[message]++
+	if info.UpstreamAddr != "" {
+		handler.upstreamCountMap[info.UpstreamAddr]++
+	}
+	if uri != "" {
+		handler.uriCountMap[uri]++
+	}
+}
+
+func (handler *MostFrequentErrorsHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	fmt.Println("levels:")
+	for _, level := range parser.ErrorLevels {
+		if count, ok := handler.levelCountMap[level]; ok {
+			fmt.Printf("  |--\"%v\" hits: %v\n", level, count)
+		}
+	}
+	for _, group := range []struct {
+		name     string
+		countMap map[string]int
+	}{
+		{"messages", handler.messageCountMap},
+		{"upstreams", handler.upstreamCountMap},
+		{"uris", handler.uriCountMap},
+	} {
+		fmt.Printf("%v:\n", group.name)
+		keys := make([]string, 0, len(group.countMap))
+		for k := range group.countMap {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if group.countMap[keys[i]] != group.countMap[keys[j]] {
+				return group.countMap[keys[i]] > group.countMap[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		for i := 0; i < limit && i < len(keys); i++ {
+			fmt.Printf("  |--\"%v\" hits: %v\n", keys[i], group.countMap[keys[i]])
+		}
+	}
+}
+
+// messageTemplate normalizes the message by replacing the quoted strings and numbers, e.g.
+// `open() "/var/www/a.png" failed (2: No such file or directory)` is normalized to
+// `open() "*" failed (N: No such file or directory)`.
+func messageTemplate(message string) string {
+	message = quotedRegex.ReplaceAllString(message, `"*"`)
+	return numberRegex.ReplaceAllString(message, "N")
+}
+
+type mostFrequentErrorsState struct {
+	LevelCountMap    map[string]int `json:"levels"`
+	MessageCountMap  map[string]int `json:"messages"`
+	UpstreamCountMap map[string]int `json:"upstreams"`
+	UriCountMap      map[string]int `json:"uris"`
+}
+
+func (handler *MostFrequentErrorsHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, mostFrequentErrorsState{
+		LevelCountMap:    handler.levelCountMap,
+		MessageCountMap:  handler.messageCountMap,
+		UpstreamCountMap: handler.upstreamCountMap,
+		UriCountMap:      handler.uriCountMap,
+	})
+}
+
+func (handler *MostFrequentErrorsHandler) LoadState(r io.Reader) error {
+	var state mostFrequentErrorsState
+	if err := decodeState(r, &state); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeCounts(handler.levelCountMap, state.LevelCountMap)
+	mergeCounts(handler.messageCountMap, state.MessageCountMap)
+	mergeCounts(handler.upstreamCountMap, state.UpstreamCountMap)
+	mergeCounts(handler.uriCountMap, state.UriCountMap)
+	return nil
+}
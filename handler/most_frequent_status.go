@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"sync"
 
@@ -27,6 +28,19 @@ func NewMostFrequentStatusHandler() *MostFrequentStatusHandler {
 func (handler *MostFrequentStatusHandler) Input(info *parser.LogInfo) {
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
+	handler.input(info)
+}
+
+func (handler *MostFrequentStatusHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *MostFrequentStatusHandler) input(info *parser.LogInfo) {
+	uri := info.Uri()
 	if _, ok := handler.statusUriCountMap[info.Status]; !ok {
 		handler.statusCountMap[info.Status] = 1
 		handler.statusUriCountMap[info.Status] = make(map[string]int)
@@ -34,14 +48,16 @@ func (handler *MostFrequentStatusHandler) Input(info *parser.LogInfo) {
 		handler.statusCountMap[info.Status]++
 	}
 
-	if _, ok := handler.statusUriCountMap[info.Status][info.Request]; !ok {
-		handler.statusUriCountMap[info.Status][info.Request] = 1
+	if _, ok := handler.statusUriCountMap[info.Status][uri]; !ok {
+		handler.statusUriCountMap[info.Status][uri] = 1
 	} else {
-		handler.statusUriCountMap[info.Status][info.Request]++
+		handler.statusUriCountMap[info.Status][uri]++
 	}
 }
 
 func (handler *MostFrequentStatusHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	statusCountKeys := make([]int, 0, len(handler.statusCountMap))
 	for k := range handler.statusCountMap {
 		statusCountKeys = append(statusCountKeys, k)
@@ -67,3 +83,34 @@ func (handler *MostFrequentStatusHandler) Output(limit int) {
 		}
 	}
 }
+
+type mostFrequentStatusState struct {
+	StatusCountMap    map[int]int            `json:"status"`
+	StatusUriCountMap map[int]map[string]int `json:"uris"`
+}
+
+func (handler *MostFrequentStatusHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, mostFrequentStatusState{
+		StatusCountMap:    handler.statusCountMap,
+		StatusUriCountMap: handler.statusUriCountMap,
+	})
+}
+
+func (handler *MostFrequentStatusHandler) LoadState(r io.Reader) error {
+	var state mostFrequentStatusState
+	if err := decodeState(r, &state); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeCounts(handler.statusCountMap, state.StatusCountMap)
+	for status, uriCountMap := range state.StatusUriCountMap {
+		if _, ok := handler.statusUriCountMap[status]; !ok {
+			handler.statusUriCountMap[status] = make(map[string]int)
+		}
+		mergeCounts(handler.statusUriCountMap[status], uriCountMap)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"sync"
 
@@ -24,20 +25,32 @@ func NewMostVisitedFieldsHandler(analysisType int) *MostVisitedFieldsHandler {
 }
 
 func (handler *MostVisitedFieldsHandler) Input(info *parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	handler.input(info)
+}
+
+func (handler *MostVisitedFieldsHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *MostVisitedFieldsHandler) input(info *parser.LogInfo) {
 	var field string
 	switch handler.analysisType {
 	case AnalysisTypeVisitedIps:
 		field = info.RemoteAddr
 	case AnalysisTypeVisitedUris:
-		field = info.Request
+		field = info.Uri()
 	case AnalysisTypeVisitedUserAgents:
 		field = info.HttpUserAgent
 	default:
 		ioutil.Fatal("unsupported analysis type: %v\n", handler.analysisType)
 		return
 	}
-	handler.mu.Lock()
-	defer handler.mu.Unlock()
 	if _, ok := handler.countMap[field]; ok {
 		handler.countMap[field]++
 	} else {
@@ -46,6 +59,8 @@ func (handler *MostVisitedFieldsHandler) Input(info *parser.LogInfo) {
 }
 
 func (handler *MostVisitedFieldsHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	keys := make([]string, 0, len(handler.countMap))
 	for k := range handler.countMap {
 		keys = append(keys, k)
@@ -59,3 +74,20 @@ func (handler *MostVisitedFieldsHandler) Output(limit int) {
 		fmt.Printf("\"%v\" hits: %v\n", keys[i], handler.countMap[keys[i]])
 	}
 }
+
+func (handler *MostVisitedFieldsHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, handler.countMap)
+}
+
+func (handler *MostVisitedFieldsHandler) LoadState(r io.Reader) error {
+	var countMap map[string]int
+	if err := decodeState(r, &countMap); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeCounts(handler.countMap, countMap)
+	return nil
+}
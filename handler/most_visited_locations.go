@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"sort"
 	"strings"
@@ -89,6 +90,24 @@ func (handler *MostVisitedLocationsHandler) Input(info *parser.LogInfo) {
 
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
+	handler.input(info, country, city)
+}
+
+func (handler *MostVisitedLocationsHandler) InputBatch(infos []*parser.LogInfo) {
+	// locations are queried out of the lock
+	locations := make([][2]string, len(infos))
+	for i, info := range infos {
+		locations[i][0], locations[i][1] = handler.queryIpLocation(info.RemoteAddr)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for i, info := range infos {
+		handler.input(info, locations[i][0], locations[i][1])
+	}
+}
+
+func (handler *MostVisitedLocationsHandler) input(info *parser.LogInfo, country, city string) {
 	// save or update by country
 	if _, ok := handler.countryCityIpCountMap[country]; !ok {
 		handler.countryCountMap[country] = 1
@@ -115,7 +134,8 @@ func (handler *MostVisitedLocationsHandler) Input(info *parser.LogInfo) {
 }
 
 func (handler *MostVisitedLocationsHandler) Output(limit int) {
-	defer handler.geoLite2Db.Close()
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	countryMap := make(map[string]string)
 	countryCountKeys := make([]string, 0, len(handler.countryCityIpCountMap))
 	for k := range handler.countryCityIpCountMap {
@@ -167,6 +187,11 @@ func (handler *MostVisitedLocationsHandler) Output(limit int) {
 	fmt.Println(countryMap)
 }
 
+// Close closes the MaxMind-DB, after the last Output.
+func (handler *MostVisitedLocationsHandler) Close() error {
+	return handler.geoLite2Db.Close()
+}
+
 func (handler *MostVisitedLocationsHandler) queryIpLocation(ip string) (string, string) {
 	record, err := handler.geoLite2Db.City(net.ParseIP(ip))
 	if record == nil {
@@ -209,3 +234,45 @@ func (handler *MostVisitedLocationsHandler) cachedQueryIpLocation(ip string) (st
 		return country, city
 	}
 }
+
+type mostVisitedLocationsState struct {
+	CountryCountMap       map[string]int                       `json:"countries"`
+	CountryCityCountMap   map[string]map[string]int            `json:"cities"`
+	CountryCityIpCountMap map[string]map[string]map[string]int `json:"ips"`
+}
+
+func (handler *MostVisitedLocationsHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, mostVisitedLocationsState{
+		CountryCountMap:       handler.countryCountMap,
+		CountryCityCountMap:   handler.countryCityCountMap,
+		CountryCityIpCountMap: handler.countryCityIpCountMap,
+	})
+}
+
+func (handler *MostVisitedLocationsHandler) LoadState(r io.Reader) error {
+	var state mostVisitedLocationsState
+	if err := decodeState(r, &state); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	mergeCounts(handler.countryCountMap, state.CountryCountMap)
+	for country, cityCountMap := range state.CountryCityCountMap {
+		if _, ok := handler.countryCityCountMap[country]; !ok {
+			handler.countryCityCountMap[country] = make(map[string]int)
+			handler.countryCityIpCountMap[country] = make(map[string]map[string]int)
+		}
+		mergeCounts(handler.countryCityCountMap[country], cityCountMap)
+	}
+	for country, cityIpCountMap := range state.CountryCityIpCountMap {
+		for city, ipCountMap := range cityIpCountMap {
+			if _, ok := handler.countryCityIpCountMap[country][city]; !ok {
+				handler.countryCityIpCountMap[country][city] = make(map[string]int)
+			}
+			mergeCounts(handler.countryCityIpCountMap[country][city], ipCountMap)
+		}
+	}
+	return nil
+}
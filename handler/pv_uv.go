@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 
@@ -26,6 +27,18 @@ func NewPvAndUvHandler() *PvAndUvHandler {
 func (handler *PvAndUvHandler) Input(info *parser.LogInfo) {
 	handler.mu.Lock()
 	defer handler.mu.Unlock()
+	handler.input(info)
+}
+
+func (handler *PvAndUvHandler) InputBatch(infos []*parser.LogInfo) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	for _, info := range infos {
+		handler.input(info)
+	}
+}
+
+func (handler *PvAndUvHandler) input(info *parser.LogInfo) {
 	atomic.AddInt32(&handler.pv, 1)
 	if _, ok := handler.uniqMap[info.RemoteAddr]; !ok {
 		atomic.AddInt32(&handler.uv, 1)
@@ -34,6 +47,36 @@ func (handler *PvAndUvHandler) Input(info *parser.LogInfo) {
 }
 
 func (handler *PvAndUvHandler) Output(limit int) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
 	fmt.Printf("PV: %v\n", atomic.LoadInt32(&handler.pv))
 	fmt.Printf("UV: %v\n", atomic.LoadInt32(&handler.uv))
 }
+
+type pvAndUvState struct {
+	Pv      int32           `json:"pv"`
+	UniqMap map[string]bool `json:"uniq"`
+}
+
+func (handler *PvAndUvHandler) SaveState(w io.Writer) error {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	return encodeState(w, pvAndUvState{Pv: handler.pv, UniqMap: handler.uniqMap})
+}
+
+func (handler *PvAndUvHandler) LoadState(r io.Reader) error {
+	var state pvAndUvState
+	if err := decodeState(r, &state); err != nil {
+		return err
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	atomic.AddInt32(&handler.pv, state.Pv)
+	for addr := range state.UniqMap {
+		if !handler.uniqMap[addr] {
+			atomic.AddInt32(&handler.uv, 1)
+			handler.uniqMap[addr] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fantasticmao/nginx-log-analyzer/handler"
+	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+)
+
+// fingerprintSize is the maximum size of the head of a log file, which identifies the file
+// whatever its path is, e.g. after it is rotated or compressed.
+const fingerprintSize = 1024
+
+type (
+	// checkpoint is where the last run stopped reading a log file.
+	checkpoint struct {
+		Path        string `json:"path"`
+		Dev         uint64 `json:"dev"`
+		Ino         uint64 `json:"ino"`
+		Offset      int64  `json:"offset"`      // the read bytes of the decompressed content
+		HeadSize    int    `json:"head_size"`   // the size of the fingerprinted head
+		Fingerprint string `json:"fingerprint"` // the sha256 of the head
+	}
+
+	// incrementalState is the state of the '-incremental' mode, which is saved in the
+	// configuration directory after each run.
+	incrementalState struct {
+		file        string
+		Checkpoints []*checkpoint   `json:"checkpoints"`
+		Handler     json.RawMessage `json:"handler,omitempty"`
+		// checkpoints of this run, the checkpoints of the files not analyzed are dropped
+		updated []*checkpoint
+		used    map[*checkpoint]bool
+		mu      sync.Mutex
+	}
+)
+
+// incrementalKey identifies the analysis of the log files, analyses of different types or
+// different log files are saved separately. The rotated members of a log are identified by
+// the current member, so that a glob like "access.log*" is the same analysis after rotation.
+func incrementalKey(logFiles []string) string {
+	var (
+		names = make([]string, 0, len(logFiles))
+		seen  = make(map[string]bool)
+	)
+	for _, logFile := range logFiles {
+		name := logFile
+		if logFile != ioutil.Stdin && !ioutil.IsURL(logFile) {
+			absFile, err := filepath.Abs(ioutil.RotationName(logFile))
+			if err != nil {
+				ioutil.Fatal("get absolute path error: %v\n", err.Error())
+				return ""
+			}
+			name = absFile
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	key := fmt.Sprintf("%v\n%v\n%v\n%v\n%v", analysisType, percentile, logFormat, nginxConf, strings.Join(names, "\n"))
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadIncrementalState reads the state of the last run, and merges its handler state into
+// the handler.
+func loadIncrementalState(key string, h handler.Handler) *incrementalState {
+	state := &incrementalState{
+		file: path.Join(configDir, "incremental-"+key+".json"),
+		used: make(map[*checkpoint]bool),
+	}
+	stateful, ok := h.(handler.StatefulHandler)
+	if !ok {
+		ioutil.Fatal("unsupported analysis type in '-incremental' mode: %v\n", analysisType)
+		return nil
+	}
+	data, err := os.ReadFile(state.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state
+	} else if err != nil {
+		ioutil.Fatal("read incremental state error: %v\n", err.Error())
+		return nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		ioutil.Fatal("decode incremental state %v error: %v\n", state.file, err.Error())
+		return nil
+	}
+	if len(state.Handler) > 0 {
+		if err := stateful.LoadState(bytes.NewReader(state.Handler)); err != nil {
+			ioutil.Fatal("load handler state error: %v\n", err.Error())
+			return nil
+		}
+	}
+	return state
+}
+
+// resume returns the checkpoint of the log file in this run, which starts from the offset
+// of the matched checkpoint of the last run. Checkpoints are matched by the fingerprint of
+// the head, so that rotated and compressed files are resumed as well, and the file with the
+// same device and inode numbers is preferred.
+func (s *incrementalState) resume(logFile string, file *os.File, reader *bufio.Reader) *checkpoint {
+	info, err := file.Stat()
+	if err != nil {
+		ioutil.Fatal("stat file error: %v\n", err.Error())
+		return nil
+	}
+	// the whole content of files shorter than fingerprintSize
+	head, _ := reader.Peek(fingerprintSize)
+	dev, ino := ioutil.FileID(info)
+	current := &checkpoint{
+		Path:        logFile,
+		Dev:         dev,
+		Ino:         ino,
+		HeadSize:    len(head),
+		Fingerprint: fingerprint(head),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched *checkpoint
+	for _, cp := range s.Checkpoints {
+		if s.used[cp] || cp.HeadSize > len(head) || cp.Fingerprint != fingerprint(head[:cp.HeadSize]) {
+			continue
+		}
+		if matched == nil || (cp.Dev == dev && cp.Ino == ino) {
+			matched = cp
+		}
+	}
+	if matched != nil {
+		s.used[matched] = true
+		current.Offset = matched.Offset
+	}
+	s.updated = append(s.updated, current)
+	return current
+}
+
+// save writes the checkpoints of this run and the handler state to the configuration
+// directory.
+func (s *incrementalState) save(h handler.Handler) error {
+	var buf bytes.Buffer
+	if err := h.(handler.StatefulHandler).SaveState(&buf); err != nil {
+		return err
+	}
+	s.Checkpoints, s.Handler = s.updated, buf.Bytes()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode incremental state error: %v", err.Error())
+	}
+
+	if err := os.MkdirAll(path.Dir(s.file), 0o755); err != nil {
+		return fmt.Errorf("create configuration directory error: %v", err.Error())
+	}
+	// written to a temporary file first, the state is never half written
+	tmpFile := s.file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return fmt.Errorf("write incremental state error: %v", err.Error())
+	}
+	if err := os.Rename(tmpFile, s.file); err != nil {
+		return fmt.Errorf("write incremental state error: %v", err.Error())
+	}
+	return nil
+}
+
+func fingerprint(head []byte) string {
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:])
+}
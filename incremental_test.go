@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fantasticmao/nginx-log-analyzer/handler"
+	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// pvOf returns the PV of the PvAndUvHandler.
+func pvOf(t *testing.T, h handler.Handler) int {
+	var (
+		buf   bytes.Buffer
+		state struct {
+			Pv int `json:"pv"`
+		}
+	)
+	assert.Nil(t, h.(handler.StatefulHandler).SaveState(&buf))
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &state))
+	return state.Pv
+}
+
+func TestIncrementalPastEnd(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log")
+	data := writeLog(t, file, 100, 0)
+	configDir = dir
+	workers = 2
+
+	loganalyzer := newTestAnalyzer(onErrorFail, "")
+	loganalyzer.incremental = loadIncrementalState("past", loganalyzer.handler)
+	assert.False(t, processLog(loganalyzer, file))
+	loganalyzer.pool.close()
+	assert.Nil(t, loganalyzer.incremental.save(loganalyzer.handler))
+
+	// the file is skipped, and its checkpoint is kept
+	loganalyzer = newTestAnalyzer(onErrorFail, "")
+	loganalyzer.util = logStart.Add(-time.Hour)
+	loganalyzer.incremental = loadIncrementalState("past", loganalyzer.handler)
+	assert.True(t, processLog(loganalyzer, file))
+	loganalyzer.pool.close()
+	assert.Nil(t, loganalyzer.incremental.save(loganalyzer.handler))
+
+	state := loadIncrementalState("past", handler.NewPvAndUvHandler())
+	assert.Equal(t, 1, len(state.Checkpoints))
+	assert.Equal(t, int64(len(data)), state.Checkpoints[0].Offset)
+}
+
+func TestIncrementalEndTime(t *testing.T) {
+	configDir = t.TempDir()
+	workers = 4
+	// the larger file is read in order rather than in chunks, since the end time is specified
+	for _, n := range []int{1000, 120000} {
+		file := filepath.Join(configDir, fmt.Sprintf("access-%d.log", n))
+		writeLog(t, file, n, 0)
+		key := strconv.Itoa(n)
+
+		loganalyzer := newTestAnalyzer(onErrorFail, "")
+		loganalyzer.util = logStart.Add(time.Duration(n/2) * time.Second)
+		loganalyzer.incremental = loadIncrementalState(key, loganalyzer.handler)
+		assert.True(t, processLog(loganalyzer, file))
+		loganalyzer.pool.close()
+		assert.Nil(t, loganalyzer.incremental.save(loganalyzer.handler))
+		assert.Equal(t, n/2+1, pvOf(t, loganalyzer.handler))
+
+		// the lines after the end time are analyzed by the next run, and only once
+		loganalyzer = newTestAnalyzer(onErrorFail, "")
+		loganalyzer.incremental = loadIncrementalState(key, loganalyzer.handler)
+		assert.False(t, processLog(loganalyzer, file))
+		loganalyzer.pool.close()
+		assert.Equal(t, n, pvOf(t, loganalyzer.handler))
+	}
+}
+
+// runIncremental analyzes the log files in '-incremental' mode, and returns the PV merged
+// with the former runs.
+func runIncremental(t *testing.T, key string, logFiles ...string) int {
+	loganalyzer := newTestAnalyzer(onErrorFail, "")
+	loganalyzer.incremental = loadIncrementalState(key, loganalyzer.handler)
+	for _, logFile := range logFiles {
+		processLog(loganalyzer, logFile)
+	}
+	loganalyzer.pool.close()
+	assert.Nil(t, loganalyzer.incremental.save(loganalyzer.handler))
+	return pvOf(t, loganalyzer.handler)
+}
+
+func TestIncrementalResume(t *testing.T) {
+	configDir = t.TempDir()
+	workers = 2
+	file := filepath.Join(configDir, "access.log")
+	writeLog(t, file, 100, 0)
+	assert.Equal(t, 100, runIncremental(t, "resume", file))
+
+	// the appended lines are analyzed, the incomplete last line is left to the next run
+	appendLog(t, file, 100, 50)
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	incomplete := logLines(150, 1, 0)
+	_, err = f.Write(incomplete[:len(incomplete)-1])
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	assert.Equal(t, 150, runIncremental(t, "resume", file))
+
+	// the rotated file is resumed where it was left, and the new file is analyzed wholly
+	f, err = os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	appendLog(t, file, 151, 9)
+	rotated := file + ".1"
+	assert.Nil(t, os.Rename(file, rotated))
+	appendLog(t, file, 160, 20)
+	assert.Equal(t, 180, runIncremental(t, "resume", rotated, file))
+
+	state := loadIncrementalState("resume", handler.NewPvAndUvHandler())
+	assert.Equal(t, 2, len(state.Checkpoints))
+	assert.Equal(t, rotated, state.Checkpoints[0].Path)
+
+	// nothing is appended
+	assert.Equal(t, 180, runIncremental(t, "resume", rotated, file))
+}
+
+func TestIncrementalKey(t *testing.T) {
+	key := incrementalKey([]string{"access.log"})
+	assert.Equal(t, key, incrementalKey([]string{"access.log.1", "access.log"}))
+	assert.Equal(t, key, incrementalKey([]string{"access.log-20211101.gz", "access.log.1", "access.log"}))
+	assert.NotEqual(t, key, incrementalKey([]string{"error.log"}))
+	assert.NotEqual(t, key, incrementalKey([]string{"access.log", "error.log"}))
+
+	// the glob expands to more members after rotation, and the checkpoints are still found
+	configDir = t.TempDir()
+	workers = 2
+	file := filepath.Join(configDir, "access.log")
+	writeLog(t, file, 100, 0)
+	logFiles, err := ioutil.ExpandFiles([]string{file + "*"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, runIncremental(t, incrementalKey(logFiles), logFiles...))
+
+	appendLog(t, file, 100, 10)
+	assert.Nil(t, os.Rename(file, file+".1"))
+	appendLog(t, file, 110, 20)
+	logFiles, err = ioutil.ExpandFiles([]string{file + "*"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{file + ".1", file}, logFiles)
+	assert.Equal(t, 130, runIncremental(t, incrementalKey(logFiles), logFiles...))
+}
+
+func TestIncrementalTolerance(t *testing.T) {
+	configDir = t.TempDir()
+	workers = 2
+	// the 50th second is out of order, and in the tolerance of the end time
+	file := filepath.Join(configDir, "access.log")
+	data := append(logLines(0, 50, 0), logLines(51, 1, 0)...)
+	data = append(data, logLines(50, 1, 0)...)
+	data = append(data, logLines(52, 48, 0)...)
+	assert.Nil(t, os.WriteFile(file, data, 0o644))
+
+	// the lines after the first line after the end time are not handled
+	loganalyzer := newTestAnalyzer(onErrorFail, "")
+	loganalyzer.util = logStart.Add(50 * time.Second)
+	loganalyzer.tolerance = time.Minute
+	loganalyzer.incremental = loadIncrementalState("tolerance", loganalyzer.handler)
+	assert.True(t, processLog(loganalyzer, file))
+	loganalyzer.pool.close()
+	assert.Nil(t, loganalyzer.incremental.save(loganalyzer.handler))
+	assert.Equal(t, 50, pvOf(t, loganalyzer.handler))
+
+	// and analyzed by the next run only once
+	assert.Equal(t, 100, runIncremental(t, "tolerance", file))
+}
@@ -0,0 +1,103 @@
+package ioutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// IsPlainFile reports whether the file is a regular text file, which can be seeked and read
+// in chunks, rather than a compressed file, a pipe or a device.
+func IsPlainFile(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	head := make([]byte, 8)
+	n, err := file.ReadAt(head, 0)
+	return (err == nil || err == io.EOF) && isText(head[:n])
+}
+
+// SplitLines splits the bytes [start, end) of the file into at most n chunks of similar
+// sizes, and returns the boundaries of the chunks, which are aligned to the lines.
+func SplitLines(file io.ReaderAt, start, end int64, n int) ([]int64, error) {
+	var (
+		bounds = []int64{start}
+		buf    = make([]byte, 4096)
+	)
+	for i := 1; i < n; i++ {
+		pos := start + (end-start)*int64(i)/int64(n)
+		if pos <= bounds[len(bounds)-1] {
+			continue
+		}
+		next, err := nextLine(file, pos, end, buf)
+		if err != nil {
+			return nil, err
+		}
+		if next > bounds[len(bounds)-1] && next < end {
+			bounds = append(bounds, next)
+		}
+	}
+	return append(bounds, end), nil
+}
+
+// nextLine returns the start of the first line at or after pos.
+func nextLine(file io.ReaderAt, pos, end int64, buf []byte) (int64, error) {
+	for off := pos - 1; off < end; off += int64(len(buf)) {
+		n, err := file.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return end, nil
+}
+
+// CompleteEnd returns the end of the last complete line of the file, the incomplete last
+// line may be still being written.
+func CompleteEnd(file io.ReaderAt, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		off := end - int64(len(buf))
+		if off < 0 {
+			off = 0
+		}
+		n, err := file.ReadAt(buf[:end-off], off)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, nil
+		}
+		end = off
+	}
+	return 0, nil
+}
+
+// CountLines returns the number of the line feeds in the bytes [start, end) of the file.
+func CountLines(file io.ReaderAt, start, end int64) (int, error) {
+	var (
+		count int
+		buf   = make([]byte, readerSize)
+	)
+	for off := start; off < end; {
+		data := buf
+		if end-off < int64(len(data)) {
+			data = data[:end-off]
+		}
+		n, err := file.ReadAt(data, off)
+		count += bytes.Count(data[:n], []byte{'\n'})
+		off += int64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package ioutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileID returns the device and inode numbers of the file.
+func FileID(info os.FileInfo) (dev, ino uint64) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino)
+	}
+	return 0, 0
+}
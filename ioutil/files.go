@@ -2,32 +2,132 @@ package ioutil
 
 import (
 	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
-func OpenFile(path string) (*os.File, bool) {
+// Stdin is the path which stands for the standard input.
+const Stdin = "-"
+
+// OpenFile opens the file of the path, or returns the standard input if the path is Stdin.
+// Named pipes and other non-seekable files are opened as they are, and read as streams.
+func OpenFile(path string) *os.File {
+	if path == Stdin {
+		return os.Stdin
+	}
 	file, err := os.Open(path)
 	if err != nil {
 		Fatal("open file error: %v\n", err.Error())
-		return nil, false
+		return nil
 	}
+	return file
+}
+
+// IsTerminal reports whether the file is a terminal, rather than a pipe, a redirected file
+// or a regular file.
+func IsTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
 
-	ext := filepath.Ext(file.Name())
-	return file, strings.EqualFold(".gz", ext)
+// readerSize is the buffer size of readers returned by ReadFile, which is also the maximum
+// size sampled by PeekLines.
+const readerSize = 64 * 1024
+
+// compression is a compression format detected by the magic bytes at the beginning of data.
+type compression struct {
+	name  string
+	magic []byte
+	// newReader returns the decompressing reader, it is nil if the format is not supported
+	newReader func(r io.Reader) (io.Reader, error)
+}
+
+var compressions = []compression{
+	{name: "gzip", magic: []byte{0x1f, 0x8b}, newReader: func(r io.Reader) (io.Reader, error) {
+		// concatenated gzip members are read as one stream
+		return gzip.NewReader(r)
+	}},
+	{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, newReader: func(r io.Reader) (io.Reader, error) {
+		return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	}},
+	{name: "bzip2", magic: []byte("BZh"), newReader: func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	}},
+	{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, newReader: func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	}},
+	{name: "zip", magic: []byte{'P', 'K', 0x03, 0x04}},
+	{name: "7z", magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{name: "lz4", magic: []byte{0x04, 0x22, 0x4d, 0x18}},
+	{name: "lzip", magic: []byte("LZIP")},
+	{name: "compress", magic: []byte{0x1f, 0x9d}},
 }
 
-func ReadFile(file *os.File, isGzip bool) (*bufio.Reader, error) {
-	if isGzip {
-		gzipReader, err := gzip.NewReader(file)
+// ReadFile returns the buffered reader of the data, the gzip, zstd, bzip2 and xz compressed
+// data is detected by its magic bytes and decompressed, whatever the file name is.
+func ReadFile(reader io.Reader) (*bufio.Reader, error) {
+	buffered := bufio.NewReaderSize(reader, readerSize)
+	head, err := buffered.Peek(8)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, c := range compressions {
+		if !bytes.HasPrefix(head, c.magic) {
+			continue
+		}
+		if c.newReader == nil {
+			return nil, fmt.Errorf("unsupported %v compressed data", c.name)
+		}
+		decompressed, err := c.newReader(buffered)
 		if err != nil {
-			return nil, fmt.Errorf("gzip new reader error: %v\n", err.Error())
+			return nil, fmt.Errorf("%v new reader error: %v", c.name, err.Error())
+		}
+		return bufio.NewReaderSize(decompressed, readerSize), nil
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, errors.New("unknown binary data, it is neither a text log nor gzip, zstd, bzip2 or xz compressed")
+	}
+	return buffered, nil
+}
+
+// isText reports whether the head of data is neither compressed nor binary.
+func isText(head []byte) bool {
+	for _, c := range compressions {
+		if bytes.HasPrefix(head, c.magic) {
+			return false
+		}
+	}
+	return bytes.IndexByte(head, 0) < 0
+}
+
+// PeekLines returns at most n complete lines from the beginning of the buffered data,
+// without advancing the reader.
+func PeekLines(reader *bufio.Reader, n int) ([][]byte, error) {
+	data, err := reader.Peek(reader.Size())
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	atEOF := err == io.EOF
+
+	lines := make([][]byte, 0, n)
+	for len(lines) < n && len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			if atEOF {
+				lines = append(lines, data)
+			}
+			break
 		}
-		return bufio.NewReader(gzipReader), nil
-	} else {
-		return bufio.NewReader(file), nil
+		lines = append(lines, data[:i+1])
+		data = data[i+1:]
 	}
+	return lines, nil
 }
@@ -1,44 +1,446 @@
 package ioutil
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestOpenFile(t *testing.T) {
-	file, isGzip := OpenFile("../testdata/access.log")
+	file := OpenFile("../testdata/access.log")
 	assert.NotNil(t, file)
-	assert.False(t, isGzip)
 
-	file, isGzip = OpenFile("../testdata/access.json.log")
+	file = OpenFile("../testdata/access.json.log")
 	assert.NotNil(t, file)
-	assert.False(t, isGzip)
 
-	file, isGzip = OpenFile("../testdata/access.json.log.1.gz")
+	file = OpenFile("../testdata/access.json.log.1.gz")
 	assert.NotNil(t, file)
-	assert.True(t, isGzip)
+}
+
+func TestOpenFileStdin(t *testing.T) {
+	assert.Equal(t, os.Stdin, OpenFile(Stdin))
+}
+
+func TestIsTerminal(t *testing.T) {
+	file := OpenFile("../testdata/access.log")
+	defer file.Close()
+	assert.False(t, IsTerminal(file))
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+	defer w.Close()
+	assert.False(t, IsTerminal(r))
 }
 
 func TestReadFile(t *testing.T) {
-	file, isGzip := OpenFile("../testdata/access.log")
-	reader, err := ReadFile(file, isGzip)
+	file := OpenFile("../testdata/access.log")
+	reader, err := ReadFile(file)
 	if err != nil {
 		assert.Error(t, err)
 	}
 	assert.NotNil(t, reader)
 
-	file, isGzip = OpenFile("../testdata/access.json.log")
-	reader, err = ReadFile(file, isGzip)
+	file = OpenFile("../testdata/access.json.log")
+	reader, err = ReadFile(file)
 	if err != nil {
 		assert.Error(t, err)
 	}
 	assert.NotNil(t, reader)
 
-	file, isGzip = OpenFile("../testdata/access.json.log.1.gz")
-	reader, err = ReadFile(file, isGzip)
+	file = OpenFile("../testdata/access.json.log.1.gz")
+	reader, err = ReadFile(file)
 	if err != nil {
 		assert.Error(t, err)
 	}
 	assert.NotNil(t, reader)
 }
+
+func TestReadFileCompressed(t *testing.T) {
+	expected, err := os.ReadFile("../testdata/access.log")
+	assert.Nil(t, err)
+
+	for _, name := range []string{"../testdata/access.log.bz2", "../testdata/access.log.xz", "../testdata/access.log.zst"} {
+		reader, err := ReadFile(OpenFile(name))
+		assert.Nil(t, err, name)
+		data, err := io.ReadAll(reader)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, data, name)
+	}
+
+	// concatenated gzip members, whatever the file name is
+	var buf bytes.Buffer
+	for _, part := range [][]byte{expected[:100], expected[100:]} {
+		writer := gzip.NewWriter(&buf)
+		_, _ = writer.Write(part)
+		assert.Nil(t, writer.Close())
+	}
+	reader, err := ReadFile(&buf)
+	assert.Nil(t, err)
+	data, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data)
+
+	// unknown compressed data
+	_, err = ReadFile(bytes.NewReader([]byte{0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7}))
+	assert.EqualError(t, err, "unsupported lz4 compressed data")
+	_, err = ReadFile(bytes.NewReader([]byte{0x01, 0x00, 0x02, 0x03}))
+	assert.NotNil(t, err)
+
+	// short data
+	reader, err = ReadFile(bytes.NewReader([]byte("a\n")))
+	assert.Nil(t, err)
+	data, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a\n"), data)
+}
+
+func TestReadFilePipe(t *testing.T) {
+	expected, err := os.ReadFile("../testdata/access.log")
+	assert.Nil(t, err)
+
+	// compressed data written to a non-seekable stream
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+	go func() {
+		writer := gzip.NewWriter(w)
+		_, _ = writer.Write(expected)
+		_ = writer.Close()
+		_ = w.Close()
+	}()
+	reader, err := ReadFile(r)
+	assert.Nil(t, err)
+	lines, err := PeekLines(reader, 2)
+	assert.Nil(t, err)
+	assert.Len(t, lines, 2)
+	data, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data)
+}
+
+func TestPeekLines(t *testing.T) {
+	file := OpenFile("../testdata/access.json.log.1.gz")
+	reader, err := ReadFile(file)
+	assert.Nil(t, err)
+
+	lines, err := PeekLines(reader, 3)
+	assert.Nil(t, err)
+	assert.Len(t, lines, 3)
+
+	// peeked lines are not consumed
+	line, err := reader.ReadBytes('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, lines[0], line)
+}
+
+func TestRotationName(t *testing.T) {
+	assert.Equal(t, "access.log", RotationName("access.log"))
+	assert.Equal(t, "access.log", RotationName("access.log.1"))
+	assert.Equal(t, "access.log", RotationName("access.log.2.gz"))
+	assert.Equal(t, "/var/log/access.log", RotationName("/var/log/access.log-20211101"))
+	assert.Equal(t, "access.log", RotationName("access.log.2021-11-01.zst"))
+	assert.Equal(t, "access.log", RotationName("access.log-20211101-1635724800.xz"))
+	assert.Equal(t, "access.json.log", RotationName("access.json.log"))
+}
+
+func TestExpandFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"access.log", "access.log.1", "access.log.10.gz", "access.log.2.gz",
+		"error.log", "error.log-20211102", "error.log-20211101.bz2", ".hidden", "sub/access.log"}
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0o755))
+		assert.Nil(t, os.WriteFile(file, nil, 0o644))
+	}
+	join := func(names ...string) []string {
+		files := make([]string, 0, len(names))
+		for _, name := range names {
+			files = append(files, filepath.Join(dir, name))
+		}
+		return files
+	}
+
+	files, err := ExpandFiles([]string{dir}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, join("access.log.10.gz", "access.log.2.gz", "access.log.1", "access.log",
+		"error.log-20211101.bz2", "error.log-20211102", "error.log"), files)
+
+	files, err = ExpandFiles([]string{dir}, true)
+	assert.Nil(t, err)
+	assert.Len(t, files, 8)
+	assert.Equal(t, filepath.Join(dir, "sub/access.log"), files[7])
+
+	// globs and duplicated paths
+	files, err = ExpandFiles([]string{filepath.Join(dir, "access.log"), filepath.Join(dir, "access.log*")}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, join("access.log.10.gz", "access.log.2.gz", "access.log.1", "access.log"), files)
+
+	files, err = ExpandFiles([]string{Stdin, "https://example.com/access.log?token=*", filepath.Join(dir, "missing.log")}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{Stdin, "https://example.com/access.log?token=*", filepath.Join(dir, "missing.log")}, files)
+
+	_, err = ExpandFiles([]string{filepath.Join(dir, "missing*.log")}, false)
+	assert.NotNil(t, err)
+}
+
+func TestFollower(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	assert.Nil(t, os.WriteFile(path, []byte("1\n2"), 0o644))
+
+	var (
+		lines  = make(chan string, 10)
+		resets = make(chan struct{}, 10)
+		done   = make(chan struct{})
+		result = make(chan error)
+	)
+	go func() {
+		result <- NewFollower(path, 10*time.Millisecond).Follow(done, func(line []byte) {
+			lines <- string(line)
+		}, func() {
+			resets <- struct{}{}
+		})
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+	appendFile := func(name, data string) {
+		file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		assert.Nil(t, err)
+		_, _ = file.WriteString(data)
+		assert.Nil(t, file.Close())
+	}
+
+	// the incomplete line is waited for
+	assert.Equal(t, "1\n", next())
+	appendFile(path, "\n3\n")
+	assert.Equal(t, "2\n", next())
+	assert.Equal(t, "3\n", next())
+
+	// rotated by renaming
+	assert.Nil(t, os.Rename(path, path+".1"))
+	appendFile(path+".1", "4\n")
+	appendFile(path, "5\n")
+	assert.Equal(t, "4\n", next())
+	<-resets
+	assert.Equal(t, "5\n", next())
+
+	// truncated by copytruncate
+	assert.Nil(t, os.WriteFile(path, nil, 0o644))
+	<-resets
+	appendFile(path, "6\n")
+	assert.Equal(t, "6\n", next())
+
+	close(done)
+	assert.Nil(t, <-result)
+}
+
+func TestParseHeader(t *testing.T) {
+	header, err := ParseHeader([]string{"Authorization: Bearer token", "X-Trace:1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Equal(t, "1", header.Get("X-Trace"))
+
+	_, err = ParseHeader([]string{"Authorization"})
+	assert.NotNil(t, err)
+}
+
+func TestOpenURL(t *testing.T) {
+	expected, err := os.ReadFile("../testdata/access.log")
+	assert.Nil(t, err)
+	compressed, err := os.ReadFile("../testdata/access.log.zst")
+	assert.Nil(t, err)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.URL.Path == "/broken.log" && r.Header.Get("Range") == "" {
+			// the connection is broken in the middle of the body
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(expected)))
+			_, _ = w.Write(expected[:100])
+			return
+		}
+		content := expected
+		if r.URL.Path == "/access.log.zst" {
+			content = compressed
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	header := http.Header{"Authorization": {"Bearer token"}}
+
+	for _, path := range []string{"/access.log", "/access.log.zst", "/broken.log"} {
+		body, err := OpenURL(server.Client(), server.URL+path, header)
+		assert.Nil(t, err, path)
+		reader, err := ReadFile(body)
+		assert.Nil(t, err, path)
+		data, err := io.ReadAll(reader)
+		assert.Nil(t, err, path)
+		assert.Equal(t, expected, data, path)
+		assert.Nil(t, body.Close())
+	}
+	assert.Equal(t, []string{"", "", "", "bytes=100-"}, ranges)
+
+	_, err = OpenURL(server.Client(), server.URL+"/access.log", nil)
+	assert.EqualError(t, err, "request "+server.URL+"/access.log error: 401 Unauthorized")
+}
+
+func TestSeekTime(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		if i%1000 == 0 {
+			// lines without time are skipped when probing
+			buf.WriteString("-\n")
+		}
+		buf.WriteString(strconv.Itoa(i/10) + " padding\n")
+	}
+	data := buf.Bytes()
+	timeOf := func(line []byte) (time.Time, bool) {
+		sec, _, _ := strings.Cut(string(line), " ")
+		n, err := strconv.ParseInt(strings.TrimSpace(sec), 10, 64)
+		return time.Unix(n, 0), err == nil
+	}
+
+	for _, sec := range []int64{0, 1, 4321, 9999, 20000} {
+		offset, err := SeekTime(bytes.NewReader(data), int64(len(data)), time.Unix(sec, 0), timeOf)
+		assert.Nil(t, err)
+		// a line boundary, before the first line not before t
+		assert.True(t, offset == 0 || data[offset-1] == '\n', sec)
+		first := bytes.Index(data, []byte("\n"+strconv.FormatInt(sec, 10)+" "))
+		if first < 0 {
+			first = len(data)
+		}
+		assert.LessOrEqual(t, offset, int64(first+1), sec)
+		assert.Greater(t, offset+int64(2*readerSize), int64(first), sec)
+	}
+
+	// compressed files can not be searched
+	compressed, err := os.ReadFile("../testdata/access.log.zst")
+	assert.Nil(t, err)
+	offset, err := SeekTime(bytes.NewReader(compressed), int64(len(compressed)), time.Unix(1, 0), timeOf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), offset)
+}
+
+func TestSkip(t *testing.T) {
+	expected, err := os.ReadFile("../testdata/access.log")
+	assert.Nil(t, err)
+
+	for _, name := range []string{"../testdata/access.log", "../testdata/access.log.zst"} {
+		file := OpenFile(name)
+		reader, err := ReadFile(file)
+		assert.Nil(t, err, name)
+		assert.Nil(t, Skip(file, reader, 100), name)
+		data, err := io.ReadAll(reader)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected[100:], data, name)
+		assert.Nil(t, file.Close())
+	}
+}
+
+func TestFileID(t *testing.T) {
+	info1, err := os.Stat("../testdata/access.log")
+	assert.Nil(t, err)
+	info2, err := os.Stat("../testdata/access.log.zst")
+	assert.Nil(t, err)
+	dev1, ino1 := FileID(info1)
+	dev2, ino2 := FileID(info2)
+	assert.Equal(t, dev1, dev2)
+	assert.NotEqual(t, ino1, ino2)
+}
+
+func TestSplitLines(t *testing.T) {
+	data := []byte("a\nbb\nccc\ndddd\neeeee\nffffff\n")
+	file := bytes.NewReader(data)
+
+	bounds, err := SplitLines(file, 0, int64(len(data)), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 9, 20, 27}, bounds)
+	for _, bound := range bounds[1 : len(bounds)-1] {
+		assert.Equal(t, byte('\n'), data[bound-1])
+	}
+
+	// more chunks than lines
+	bounds, err = SplitLines(file, 5, int64(len(data)), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 9, 14, 20, 27}, bounds)
+
+	bounds, err = SplitLines(file, 0, int64(len(data)), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 27}, bounds)
+}
+
+func TestCountLines(t *testing.T) {
+	data := []byte("a\nbb\nccc\ndddd\neeeee\nffffff")
+	file := bytes.NewReader(data)
+
+	count, err := CountLines(file, 0, int64(len(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+
+	count, err = CountLines(file, 5, 14)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = CountLines(file, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+}
+
+func TestCompleteEnd(t *testing.T) {
+	end, err := CompleteEnd(bytes.NewReader([]byte("a\nbb\ncc")), 7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), end)
+
+	end, err = CompleteEnd(bytes.NewReader([]byte("a\nbb\n")), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), end)
+
+	end, err = CompleteEnd(bytes.NewReader([]byte("abc")), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), end)
+
+	data := append(bytes.Repeat([]byte("x\n"), 5000), 'y')
+	end, err = CompleteEnd(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)-1), end)
+}
+
+func TestIsPlainFile(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"../testdata/access.log":     true,
+		"../testdata/access.log.zst": false,
+		"../testdata/access.log.xz":  false,
+	} {
+		file := OpenFile(name)
+		assert.Equal(t, expected, IsPlainFile(file), name)
+		assert.Nil(t, file.Close())
+	}
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+	defer w.Close()
+	assert.False(t, IsPlainFile(r))
+}
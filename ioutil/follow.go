@@ -0,0 +1,128 @@
+package ioutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Follower reads the lines of a file and the lines appended to it later, like `tail -F`.
+// The file is re-opened when it is rotated, i.e. its path is replaced by another file, and
+// read again from the beginning when it is truncated.
+type Follower struct {
+	path string
+	poll time.Duration
+}
+
+func NewFollower(path string, poll time.Duration) *Follower {
+	return &Follower{
+		path: path,
+		poll: poll,
+	}
+}
+
+// Follow calls handle with each complete line of the file until done is closed, the file is
+// waited for if it does not exist yet. Before the lines of a rotated or truncated file, reset
+// is called.
+func (f *Follower) Follow(done <-chan struct{}, handle func(line []byte), reset func()) error {
+	var (
+		file   *os.File
+		reader *bufio.Reader
+		offset int64  // the read bytes of the file
+		line   []byte // the incomplete last line, which is still being written
+	)
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	for {
+		if file == nil {
+			opened, err := os.Open(f.path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("open file error: %v", err.Error())
+			}
+			if err == nil {
+				file, reader, offset, line = opened, bufio.NewReaderSize(opened, readerSize), 0, nil
+			}
+		}
+
+		if file != nil {
+			for {
+				data, err := reader.ReadBytes('\n')
+				offset += int64(len(data))
+				if line == nil {
+					line = data
+				} else {
+					line = append(line, data...)
+				}
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("read file error: %v", err.Error())
+				}
+				handle(line)
+				line = nil
+			}
+			if len(line) == 0 {
+				line = nil
+			}
+
+			rotated, truncated, err := f.changed(file, offset)
+			if err != nil {
+				return err
+			}
+			if truncated {
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					return fmt.Errorf("seek file error: %v", err.Error())
+				}
+				reader.Reset(file)
+				offset, line = 0, nil
+				reset()
+				continue
+			}
+			if rotated {
+				// the old file has been read to the end
+				if line != nil {
+					handle(line)
+				}
+				if err := file.Close(); err != nil {
+					return fmt.Errorf("close file error: %v", err.Error())
+				}
+				file = nil
+				reset()
+				continue
+			}
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(f.poll):
+		}
+	}
+}
+
+// changed reports whether the path has been replaced by another file, or the opened file
+// has been truncated. The opened file is kept until the new file is created, since it may
+// still be written after it is renamed.
+func (f *Follower) changed(file *os.File, offset int64) (rotated, truncated bool, err error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return false, false, fmt.Errorf("stat file error: %v", err.Error())
+	}
+	if stat.Size() < offset {
+		return false, true, nil
+	}
+	pathStat, err := os.Stat(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, fmt.Errorf("stat file error: %v", err.Error())
+	}
+	return !os.SameFile(stat, pathStat), false, nil
+}
@@ -0,0 +1,129 @@
+package ioutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// httpRetries is the maximum times of resuming a broken response without progress.
+const httpRetries = 3
+
+// IsURL reports whether the path is an HTTP or HTTPS URL.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// ParseHeader parses the "Name: value" headers, e.g. "Authorization: Bearer token".
+func ParseHeader(lines []string) (http.Header, error) {
+	header := make(http.Header, len(lines))
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("illegal header: %v", line)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// httpReader reads the body of a URL, the request is resumed from the read offset with a
+// Range header when the connection is broken.
+type httpReader struct {
+	client    *http.Client
+	url       string
+	header    http.Header
+	body      io.ReadCloser
+	offset    int64
+	validator string // the ETag or Last-Modified of the first response, to resume the same file
+	retries   int
+}
+
+// OpenURL requests the URL with the header, and returns the body which is resumed when the
+// connection is broken. The body is requested without Content-Encoding, the compressed files
+// are detected by ReadFile anyway.
+func OpenURL(client *http.Client, url string, header http.Header) (io.ReadCloser, error) {
+	r := &httpReader{
+		client: client,
+		url:    url,
+		header: header,
+	}
+	if err := r.request(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *httpReader) request() error {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("new request error: %v", err.Error())
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	// byte ranges of the transparently decompressed body are meaningless
+	req.Header.Set("Accept-Encoding", "identity")
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		if r.validator != "" {
+			req.Header.Set("If-Range", r.validator)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %v error: %v", r.url, err.Error())
+	}
+	switch {
+	case r.offset == 0 && resp.StatusCode == http.StatusOK:
+		if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			r.validator = etag
+		} else {
+			r.validator = resp.Header.Get("Last-Modified")
+		}
+	case r.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+	case r.offset > 0 && resp.StatusCode == http.StatusOK:
+		_ = resp.Body.Close()
+		return fmt.Errorf("resume %v error: range is not supported or the file has changed", r.url)
+	default:
+		_ = resp.Body.Close()
+		return fmt.Errorf("request %v error: %v", r.url, resp.Status)
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.retries = 0
+		}
+		if err == nil || errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		// the connection is broken, resume from the offset
+		_ = r.body.Close()
+		r.body = http.NoBody
+		if r.retries >= httpRetries {
+			return n, err
+		}
+		r.retries++
+		if resumeErr := r.request(); resumeErr != nil {
+			return n, fmt.Errorf("%v, %v", err.Error(), resumeErr.Error())
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
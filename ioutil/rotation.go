@@ -0,0 +1,190 @@
+package ioutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compressedExts are the file extensions appended by logrotate and friends when compressing
+// rotated logs, the content is detected by ReadFile anyway.
+var compressedExts = []string{".gz", ".zst", ".zstd", ".bz2", ".xz"}
+
+var (
+	// datedSuffix matches the suffixes of logrotate dateext, e.g. "-20211101", ".2021-11-01"
+	// and "-20211101-1635724800"
+	datedSuffix = regexp.MustCompile(`[._-](\d{4}-?\d{2}-?\d{2}(?:[-_T]?\d{2,})*)$`)
+	// numberedSuffix matches the suffixes of numbered rotation, e.g. ".1"
+	numberedSuffix = regexp.MustCompile(`\.(\d{1,7})$`)
+)
+
+// rotation is the position of a file among the rotated members of a log.
+type rotation struct {
+	name  string // the path of the current member, e.g. "access.log" of "access.log.2.gz"
+	class int    // dated members, numbered members, and then the current member
+	dated string // the digits of the date, which sort chronologically
+	n     int    // the number of numbered members, larger is older
+}
+
+const (
+	rotationDated = iota
+	rotationNumbered
+	rotationCurrent
+)
+
+func rotationOf(path string) rotation {
+	name := path
+	for _, ext := range compressedExts {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	base := filepath.Base(name)
+	if m := datedSuffix.FindStringSubmatchIndex(base); m != nil && m[0] > 0 {
+		digits := strings.Map(func(r rune) rune {
+			if r < '0' || r > '9' {
+				return -1
+			}
+			return r
+		}, base[m[2]:m[3]])
+		return rotation{name: name[:len(name)-len(base)+m[0]], class: rotationDated, dated: digits}
+	}
+	if m := numberedSuffix.FindStringSubmatchIndex(base); m != nil && m[0] > 0 {
+		n, _ := strconv.Atoi(base[m[2]:m[3]])
+		return rotation{name: name[:len(name)-len(base)+m[0]], class: rotationNumbered, n: n}
+	}
+	return rotation{name: name, class: rotationCurrent}
+}
+
+// before reports whether the member r is older than the member o of the same log.
+func (r rotation) before(o rotation) bool {
+	if r.class != o.class {
+		return r.class < o.class
+	}
+	switch r.class {
+	case rotationDated:
+		return r.dated < o.dated
+	case rotationNumbered:
+		return r.n > o.n
+	default:
+		return false
+	}
+}
+
+// RotationName returns the path of the current member of the rotated log which the file
+// belongs to, e.g. "access.log" of "access.log.1", "access.log.2.gz" and "access.log-20211101".
+func RotationName(path string) string {
+	return rotationOf(path).name
+}
+
+// ExpandFiles expands the directories and glob patterns of the paths into files, directories
+// are recursed into if recursive is true. The files are grouped by the logs they are rotated
+// from, and the members of each log are ordered chronologically, from the oldest rotated one
+// to the current one. Stdin and URLs are kept as they are.
+func ExpandFiles(paths []string, recursive bool) ([]string, error) {
+	var (
+		files = make([]string, 0, len(paths))
+		seen  = make(map[string]bool)
+	)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, path := range paths {
+		if path == Stdin || IsURL(path) {
+			files = append(files, path)
+			continue
+		}
+		matches := []string{path}
+		if _, err := os.Stat(path); err != nil && strings.ContainsAny(path, "*?[") {
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("glob %v error: %v", path, err.Error())
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %v", path)
+			}
+		}
+		for _, match := range matches {
+			stat, err := os.Stat(match)
+			if err != nil || !stat.IsDir() {
+				// opened and reported later
+				add(match)
+				continue
+			}
+			dirFiles, err := listDir(match, recursive)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range dirFiles {
+				add(file)
+			}
+		}
+	}
+	sortRotations(files)
+	return files, nil
+}
+
+// listDir returns the regular files in the directory, hidden files are ignored.
+func listDir(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read directory %v error: %v", dir, err.Error())
+	}
+	return files, nil
+}
+
+// sortRotations orders the members of each rotated log chronologically, the logs are kept
+// in the order of their first appearance.
+func sortRotations(files []string) {
+	var (
+		rotations = make(map[string]rotation, len(files))
+		groups    = make(map[string]int)
+	)
+	for _, file := range files {
+		r := rotationOf(file)
+		rotations[file] = r
+		if _, ok := groups[r.name]; !ok {
+			groups[r.name] = len(groups)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		ri, rj := rotations[files[i]], rotations[files[j]]
+		if gi, gj := groups[ri.name], groups[rj.name]; gi != gj {
+			return gi < gj
+		}
+		return ri.before(rj)
+	})
+}
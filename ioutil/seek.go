@@ -0,0 +1,89 @@
+package ioutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SeekTime binary searches the time-ordered text file for the offset of the first line which
+// is not before t, timeOf returns the time of a line, or false if the line has no time. The
+// returned offset is at a line boundary, and only the lines before t are skipped, provided
+// that the lines are ordered. It returns 0 for compressed files, which can not be searched.
+func SeekTime(file io.ReaderAt, size int64, t time.Time, timeOf func(line []byte) (time.Time, bool)) (int64, error) {
+	buf := make([]byte, readerSize)
+	n, err := file.ReadAt(buf[:8], 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if !isText(buf[:n]) {
+		return 0, nil
+	}
+
+	// lo is the start of a line, and the first line not before t is in [lo, hi]
+	lo, hi := int64(0), size
+	for hi-lo > int64(len(buf)) {
+		mid := lo + (hi-lo)/2
+		data := buf
+		if hi-mid < int64(len(data)) {
+			data = data[:hi-mid]
+		}
+		n, err := file.ReadAt(data, mid)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		data = data[:n]
+
+		// resync at the next line boundary, and probe the first line with time
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		start, probed := i+1, false
+		for off := start; off < len(data) && !probed; {
+			j := bytes.IndexByte(data[off:], '\n')
+			if j < 0 {
+				break
+			}
+			if lt, ok := timeOf(data[off : off+j+1]); ok {
+				if lt.Before(t) {
+					lo = mid + int64(off+j+1)
+				} else {
+					hi = mid + int64(start)
+				}
+				probed = true
+			}
+			off += j + 1
+		}
+		if !probed {
+			// no time in the window, leave the rest to the sequential reading
+			break
+		}
+	}
+	return lo, nil
+}
+
+// Skip skips the first n bytes of the content of the file, which is read by the reader
+// returned by ReadFile. Plain files are seeked, and compressed files are decompressed and
+// discarded.
+func Skip(file *os.File, reader *bufio.Reader, n int64) error {
+	head := make([]byte, 8)
+	m, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("read file error: %v", err.Error())
+	}
+	if isText(head[:m]) {
+		if _, err := file.Seek(n, io.SeekStart); err != nil {
+			return fmt.Errorf("seek file error: %v", err.Error())
+		}
+		reader.Reset(file)
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, reader, n); err != nil {
+		return fmt.Errorf("skip file error: %v", err.Error())
+	}
+	return nil
+}
@@ -1,32 +1,56 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fantasticmao/nginx-log-analyzer/handler"
 	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+	"github.com/fantasticmao/nginx-log-analyzer/nginxconf"
 	"github.com/fantasticmao/nginx-log-analyzer/parser"
 )
 
 var (
-	logFiles     []string
-	showVersion  bool
-	configDir    string
-	analysisType int
-	limit        int
-	limitSecond  int
-	percentile   float64
-	timeAfter    string
-	timeBefore   string
-	logFormat    string
-	multiThread  bool
-	err          error
+	logFiles       []string
+	showVersion    bool
+	configDir      string
+	analysisType   int
+	limit          int
+	limitSecond    int
+	percentile     float64
+	timeAfter      string
+	timeBefore     string
+	tolerance      time.Duration
+	logFormat      string
+	onError        string
+	quarantine     string
+	sampleLines    int
+	nginxConf      string
+	syslog         bool
+	fieldMapping   string
+	escape         string
+	columns        string
+	workers        int
+	recursive      bool
+	follow         bool
+	followInterval int
+	headers        stringsFlag
+	incremental    bool
+	httpHeader     http.Header
+	err            error
 )
 
 var (
@@ -37,26 +61,61 @@ var (
 )
 
 type (
+	// stringsFlag is a flag which can be specified more than once.
+	stringsFlag []string
+
 	loganalyzer struct {
-		parser  parser.Parser
-		handler handler.Handler
-		since   time.Time
-		util    time.Time
-		wg      sync.WaitGroup
+		parser   parser.Parser
+		parsers  map[string]parser.Parser // parsers of the log files discovered from nginx.conf
+		handler  handler.Handler
+		rejecter *rejecter
+		since    time.Time
+		util     time.Time
+		// the maximum out-of-order time of lines, the lines are ordered by time more or less
+		tolerance time.Duration
+		// the checkpoints and handler state of the last run in '-incremental' mode
+		incremental *incrementalState
+		// the workers parsing lines, which are not used in '-f' mode
+		pool *workerPool
 	}
 )
 
-func (l *loganalyzer) add() {
-	l.wg.Add(1)
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 func NewLogAnalyzer() loganalyzer {
 	return loganalyzer{}
 }
 
+func (l *loganalyzer) parserOf(logFile string) parser.Parser {
+	p, ok := l.parsers[logFile]
+	if !ok {
+		p = l.parser
+	}
+	if _, ok := p.(parser.StatefulParser); ok {
+		// files are processed concurrently, each of them needs its own state
+		p = newLogParser()
+	}
+	if syslog && p != nil {
+		return parser.NewSyslogParser(p)
+	}
+	return p
+}
+
 func init() {
 	flag.BoolVar(&showVersion, "v", false, "show current version")
-	flag.BoolVar(&multiThread, "m", true, "use concurrent model")
+	flag.IntVar(&workers, "m", runtime.GOMAXPROCS(0), "specify the number of workers which read and parse lines concurrently")
+	flag.BoolVar(&recursive, "r", false, "recurse into the subdirectories of the directory arguments")
+	flag.BoolVar(&follow, "f", false, "follow the appended lines of the files across rotations, like 'tail -F'")
+	flag.IntVar(&followInterval, "fi", 10, "re-render the output every n seconds in '-f' mode, 0 to re-render on SIGUSR1 only")
+	flag.BoolVar(&incremental, "incremental", false, "analyze only the lines appended since the last run, and merge the results with it")
+	flag.Var(&headers, "H", "specify the header of http and https requests, e.g. 'Authorization: Bearer token', can be used more than once")
 	flag.StringVar(&configDir, "d", "", "specify the configuration directory")
 	flag.IntVar(&analysisType, "t", 0, "specify the analysis type, see documentation for more details:\nhttps://github.com/fantasticmao/nginx-log-analyzer#specify-the-analysis-type--t")
 	flag.IntVar(&limit, "n", 15, "limit the output lines number")
@@ -64,12 +123,22 @@ func init() {
 	flag.Float64Var(&percentile, "p", 95, "specify the percentile value in '-t 7' mode")
 	flag.StringVar(&timeAfter, "ta", "", "limit the analysis start time, in format of RFC3339 e.g. '2021-11-01T00:00:00+08:00'")
 	flag.StringVar(&timeBefore, "tb", "", "limit the analysis end time, in format of RFC3339 e.g. '2021-11-02T00:00:00+08:00'")
-	flag.StringVar(&logFormat, "lf", "combined", "specify the nginx log format, value should be 'combined' or 'json'")
-	flag.Parse()
-	logFiles = flag.Args()
+	flag.DurationVar(&tolerance, "tt", time.Minute, "specify the out-of-order tolerance of lines, when seeking to the '-ta' start time and stopping past the '-tb' end time")
+	flag.StringVar(&logFormat, "lf", "combined", "specify the log format, value should be 'combined', 'json', 'apache', 'iis', 'ncsa', 'caddy', 'traefik', 'haproxy', 'envoy', 'alb', 'elb', 'cloudfront', 'w3c', 'error', 'logfmt', 'csv', 'tsv', 'auto', a nginx log_format template or an Apache LogFormat string")
+	flag.IntVar(&sampleLines, "lfn", 100, "limit the sampled lines number of each file in '-lf auto' mode")
+	flag.StringVar(&onError, "on-error", onErrorFail, "specify the policy of unparsable lines, value should be 'fail', 'skip' or 'quarantine'")
+	flag.StringVar(&quarantine, "qf", "rejected.log", "specify the file which unparsable lines are written to in '-on-error quarantine' mode")
+	flag.StringVar(&nginxConf, "c", "", "specify the nginx configuration file, to discover the log formats and access logs from it")
+	flag.StringVar(&escape, "escape", parser.EscapeDefault, "specify the escape mode of the log_format template, value should be 'default', 'json' or 'none'")
+	flag.StringVar(&fieldMapping, "fm", "", "specify the field mapping of json, logfmt, csv and tsv logs, e.g. 'ts=time_iso8601,dur=request_time:ms'")
+	flag.StringVar(&columns, "columns", "", "specify the comma separated columns of csv and tsv logs without header row")
+	flag.BoolVar(&syslog, "syslog", false, "strip the RFC3164 or RFC5424 syslog headers of lines, which are detected in '-lf auto' mode")
 }
 
 func main() {
+	// parsed in main rather than init, so that the flags of tests are not parsed
+	flag.Parse()
+	logFiles = flag.Args()
 	if showVersion {
 		fmt.Printf("%v %v build at %v on commit %v\n", Name, Version, BuildTime, CommitHash)
 		return
@@ -84,6 +153,7 @@ func main() {
 		configDir = path.Join(homeDir, ".config", Name)
 	}
 	loganalyze := NewLogAnalyzer()
+	loganalyze.tolerance = tolerance
 	if timeAfter != "" {
 		loganalyze.since, err = time.Parse(time.RFC3339, timeAfter)
 		if err != nil {
@@ -99,8 +169,47 @@ func main() {
 		}
 	}
 
-	loganalyze.parser = newLogParser()
+	if workers < 1 {
+		ioutil.Fatal("the number of workers should be positive: %v\n", workers)
+		return
+	}
+
+	if len(logFiles) == 0 && nginxConf == "" {
+		if ioutil.IsTerminal(os.Stdin) {
+			flag.Usage()
+			ioutil.Fatal("no log file specified, nor piped to the standard input\n")
+			return
+		}
+		logFiles = []string{ioutil.Stdin}
+	}
+	httpHeader, err = ioutil.ParseHeader(headers)
+	if err != nil {
+		ioutil.Fatal("parse header error: %v\n", err.Error())
+		return
+	}
+	logFiles, err = ioutil.ExpandFiles(logFiles, recursive)
+	if err != nil {
+		ioutil.Fatal("expand files error: %v\n", err.Error())
+		return
+	}
+	if nginxConf != "" {
+		logFiles, loganalyze.parsers = discoverLogs(nginxConf, logFiles)
+	} else {
+		loganalyze.parser = newLogParser()
+	}
 	loganalyze.handler = newLogHandler()
+	loganalyze.rejecter = newRejecter(onError, quarantine)
+	if incremental {
+		if follow {
+			ioutil.Fatal("'-incremental' mode is not supported in '-f' mode\n")
+			return
+		}
+		loganalyze.incremental = loadIncrementalState(incrementalKey(logFiles), loganalyze.handler)
+	}
+	if follow {
+		followProcess(logFiles, &loganalyze)
+		return
+	}
 	testProcess(logFiles, &loganalyze)
 
 }
@@ -124,6 +233,8 @@ func newLogHandler() handler.Handler {
 		return handler.NewLargestAverageTimeUrisHandler()
 	case handler.AnalysisTypePercentTimeUris:
 		return handler.NewLargestPercentTimeUrisHandler(percentile)
+	case handler.AnalysisTypeErrors:
+		return handler.NewMostFrequentErrorsHandler()
 	default:
 		ioutil.Fatal("unsupported analysis type: %v\n", analysisType)
 		return nil
@@ -135,16 +246,230 @@ func newLogParser() parser.Parser {
 	case parser.LogFormatTypeCombined:
 		return parser.NewCombinedParser()
 	case parser.LogFormatTypeJson:
-		return parser.NewJsonParser()
+		return parser.NewJsonParserOf(newFieldMapping())
+	case parser.LogFormatTypeApache:
+		return parser.NewCustomParserOf(parser.ApacheFormatName)
+	case parser.LogFormatTypeIIS:
+		return parser.NewCustomParserOf(parser.IISFormatName)
+	case parser.LogFormatTypeNCSA:
+		return parser.NewCustomParserOf(parser.NCSAFormatName)
+	case parser.LogFormatTypeCaddy:
+		return parser.NewCaddyParser()
+	case parser.LogFormatTypeTraefik:
+		return parser.NewTraefikParser()
+	case parser.LogFormatTypeHAProxy:
+		return parser.NewHAProxyParser()
+	case parser.LogFormatTypeEnvoy:
+		return parser.NewEnvoyParser()
+	case parser.LogFormatTypeALB:
+		return parser.NewALBParser()
+	case parser.LogFormatTypeELB:
+		return parser.NewELBParser()
+	case parser.LogFormatTypeCF:
+		return parser.NewCloudFrontParser()
+	case parser.LogFormatTypeW3C:
+		return parser.NewW3CParser()
+	case parser.LogFormatTypeError:
+		return parser.NewErrorLogParser()
+	case parser.LogFormatTypeLogfmt:
+		return parser.NewLogfmtParser(newFieldMapping())
+	case parser.LogFormatTypeCSV:
+		return parser.NewCSVParser(newFieldMapping(), newColumns())
+	case parser.LogFormatTypeTSV:
+		return parser.NewTSVParser(newFieldMapping(), newColumns())
+	case parser.LogFormatTypeAuto:
+		// detected for each file by detectLogParser
+		return nil
 	default:
-		ioutil.Fatal("unsupported log format : %v\n", logFormat)
+		var (
+			p   *parser.LogFormatParser
+			err error
+		)
+		if strings.Contains(logFormat, "$") {
+			p, err = parser.NewLogFormatParserOf(logFormat, escape)
+		} else if strings.Contains(logFormat, "%") {
+			p, err = parser.NewApacheLogFormatParser(logFormat)
+		} else {
+			ioutil.Fatal("unsupported log format : %v\n", logFormat)
+			return nil
+		}
+		if err != nil {
+			ioutil.Fatal("compile log format error: %v\n", err.Error())
+			return nil
+		}
+		return p
+	}
+}
+
+func newFieldMapping() *parser.FieldMapping {
+	mapping, err := parser.ParseFieldMapping(fieldMapping)
+	if err != nil {
+		ioutil.Fatal("parse field mapping error: %v\n", err.Error())
 		return nil
 	}
+	return mapping
+}
+
+func newColumns() []string {
+	if columns == "" {
+		// named by the header row
+		return nil
+	}
+	return strings.Split(columns, ",")
+}
+
+// discoverLogs reads the log_format and access_log directives from the nginx configuration,
+// and returns the access logs to analyze with their parsers. When logFiles is not empty,
+// only those files are analyzed.
+func discoverLogs(confFile string, logFiles []string) ([]string, map[string]parser.Parser) {
+	config, err := nginxconf.Load(confFile)
+	if err != nil {
+		ioutil.Fatal("load nginx configuration error: %v\n", err.Error())
+		return nil, nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, logFile := range logFiles {
+		absFile, err := filepath.Abs(logFile)
+		if err != nil {
+			ioutil.Fatal("get absolute path error: %v\n", err.Error())
+			return nil, nil
+		}
+		wanted[absFile] = true
+	}
+
+	var (
+		files   = make([]string, 0, len(config.AccessLogs))
+		formats = make(map[string][]string) // the log_format names of each file
+		skipped = make(map[string]bool)
+	)
+	for _, accessLog := range config.AccessLogs {
+		if len(wanted) > 0 && !wanted[accessLog.Path] || skipped[accessLog.Path] {
+			continue
+		}
+		names, ok := formats[accessLog.Path]
+		if !ok {
+			if _, err := os.Stat(accessLog.Path); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "skip %v: %v\n", accessLog.Path, err.Error())
+				skipped[accessLog.Path] = true
+				continue
+			}
+			files = append(files, accessLog.Path)
+		}
+		if !slices.Contains(names, accessLog.Format) {
+			formats[accessLog.Path] = append(names, accessLog.Format)
+		}
+	}
+	if len(files) == 0 {
+		ioutil.Fatal("no access log found in nginx configuration: %v\n", confFile)
+	}
+
+	var (
+		parsers    = make(map[string]parser.Parser)
+		registered = make(map[string]bool)
+	)
+	for _, file := range files {
+		names := formats[file]
+		if len(names) > 1 {
+			// the lines of the log_formats are mixed in the file, its parser is detected by
+			// detectLogParser, with the log_formats as the candidates
+			for _, name := range names {
+				if registered[name] {
+					continue
+				}
+				logFormat := config.LogFormats[name]
+				if _, err := newLogFormatParser(logFormat); err != nil {
+					ioutil.Fatal("compile log_format %v error: %v\n", logFormat.Name, err.Error())
+					return nil, nil
+				}
+				parser.RegisterCandidate(parser.Candidate{
+					Name: logFormat.Name,
+					New: func() parser.Parser {
+						p, _ := newLogFormatParser(logFormat)
+						return p
+					},
+				})
+				registered[name] = true
+			}
+			parsers[file] = nil
+			_, _ = fmt.Fprintf(os.Stderr, "analyze %v with the detected log format: written by log_format %v\n",
+				file, strings.Join(names, ", "))
+			continue
+		}
+
+		logFormat := config.LogFormats[names[0]]
+		p, err := newLogFormatParser(logFormat)
+		if err != nil {
+			ioutil.Fatal("compile log_format %v error: %v\n", logFormat.Name, err.Error())
+			return nil, nil
+		}
+		parsers[file] = p
+		_, _ = fmt.Fprintf(os.Stderr, "analyze %v with log_format %v\n", file, logFormat.Name)
+	}
+	return files, parsers
+}
+
+// newLogFormatParser returns the parser of a log_format of the nginx configuration.
+func newLogFormatParser(logFormat nginxconf.LogFormat) (parser.Parser, error) {
+	if logFormat.Name == nginxconf.LogFormatCombined {
+		return parser.NewCombinedParser(), nil
+	}
+	return parser.NewLogFormatParserOf(logFormat.Format, logFormat.Escape)
+}
+
+// detectLogParser samples the first lines of the reader without consuming them, and returns
+// the parser of the best matched log format.
+func detectLogParser(logFile string, reader *bufio.Reader) parser.Parser {
+	lines, err := ioutil.PeekLines(reader, sampleLines)
+	if err != nil {
+		ioutil.Fatal("read file error: %v\n", err.Error())
+		return nil
+	}
+	if len(lines) == 0 {
+		// empty file, any parser is fine
+		return parser.NewCombinedParser()
+	}
+	// lines shipped via syslog are detected by their messages
+	messages, isSyslog := make([][]byte, 0, len(lines)), syslog
+	for _, line := range lines {
+		if _, _, message, ok := parser.SplitSyslog(line); ok {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) > len(lines)/2 {
+		lines, isSyslog = messages, true
+	}
+	candidate, matched, ok := parser.Detect(lines)
+	if !ok {
+		ioutil.Fatal("detect log format error: no format matches %v\n", logFile)
+		return nil
+	}
+	if isSyslog {
+		_, _ = fmt.Fprintf(os.Stderr, "detect %v as %v log via syslog, %v/%v sampled lines matched\n",
+			logFile, candidate.Name, matched, len(lines))
+		return parser.NewSyslogParser(candidate.New())
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "detect %v as %v log, %v/%v sampled lines matched\n",
+		logFile, candidate.Name, matched, len(lines))
+	return candidate.New()
+}
+
+// openLog opens the log file, the standard input, or the http and https URL.
+func openLog(logFile string) io.ReadCloser {
+	if ioutil.IsURL(logFile) {
+		body, err := ioutil.OpenURL(http.DefaultClient, logFile, httpHeader)
+		if err != nil {
+			ioutil.Fatal("open url error: %v\n", err.Error())
+			return nil
+		}
+		return body
+	}
+	return ioutil.OpenFile(logFile)
 }
 
 func isDateSkipAble(loganalyzer *loganalyzer, logInfo *parser.LogInfo) bool {
 	if !loganalyzer.since.IsZero() || !loganalyzer.util.IsZero() {
-		logTime := parser.ParseTime(logInfo.TimeLocal)
+		logTime := logInfo.Time
 		if !loganalyzer.since.IsZero() && logTime.Before(loganalyzer.since) {
 			// go to next line
 			return true
@@ -157,127 +482,400 @@ func isDateSkipAble(loganalyzer *loganalyzer, logInfo *parser.LogInfo) bool {
 	return false
 }
 
-func parseLog(loganalyzer *loganalyzer, data []byte) {
-	logInfo := loganalyzer.parser.ParseLog(data)
+// isPastEnd reports whether the first line of the reader is after the end time, without
+// consuming it.
+func isPastEnd(loganalyzer *loganalyzer, logParser parser.Parser, reader *bufio.Reader) bool {
+	if loganalyzer.util.IsZero() {
+		return false
+	}
+	lines, err := ioutil.PeekLines(reader, 1)
+	if err != nil || len(lines) == 0 {
+		return false
+	}
+	logInfo, err := logParser.ParseLog(lines[0])
+	return err == nil && isPastTolerance(loganalyzer, logInfo)
+}
+
+// isPastTolerance reports whether the line is past the end time by more than the tolerance,
+// then the later lines of the file are past the end time too.
+func isPastTolerance(loganalyzer *loganalyzer, logInfo *parser.LogInfo) bool {
+	return !loganalyzer.util.IsZero() && logInfo.Time.After(loganalyzer.util.Add(loganalyzer.tolerance))
+}
+
+// seekStart moves the time-ordered plain file to the first line not before the start time
+// minus the tolerance, by binary searching the lines, and returns the offset.
+func seekStart(loganalyzer *loganalyzer, logParser parser.Parser, logFile string, file io.Reader) int64 {
+	f, ok := file.(*os.File)
+	if loganalyzer.since.IsZero() || !ok || logFile == ioutil.Stdin {
+		return 0
+	}
+	if _, ok := logParser.(parser.StatefulParser); ok {
+		// lines depend on the headers, which must not be skipped
+		return 0
+	}
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return 0
+	}
+	offset, err := ioutil.SeekTime(f, stat.Size(), loganalyzer.since.Add(-loganalyzer.tolerance), func(line []byte) (time.Time, bool) {
+		logInfo, err := logParser.ParseLog(line)
+		if err != nil || logInfo.Time.IsZero() {
+			return time.Time{}, false
+		}
+		return logInfo.Time, true
+	})
+	if err != nil {
+		ioutil.Fatal("seek file error: %v\n", err.Error())
+		return 0
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			ioutil.Fatal("seek file error: %v\n", err.Error())
+			return 0
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "seek %v to offset %v, the line numbers are counted from it\n", logFile, offset)
+	}
+	return offset
+}
+
+// parseLog parses and handles the line, and returns true if the line is past the end time by
+// more than the tolerance.
+func parseLog(loganalyzer *loganalyzer, logParser parser.Parser, logFile string, lineNo int, offset int64, data []byte) bool {
+	logInfo, _, past := parseLine(loganalyzer, logParser, logFile, lineNo, offset, data)
+	if logInfo != nil {
+		loganalyzer.handler.Input(logInfo)
+	}
+	return past
+}
+
+// parseLine parses the line and filters it by the time. It returns the LogInfo to be handled,
+// which is nil if the line is skipped or rejected, whether the line is after the end time, and
+// whether the line is past the end time by more than the tolerance.
+func parseLine(loganalyzer *loganalyzer, logParser parser.Parser, logFile string, lineNo int, offset int64, data []byte) (*parser.LogInfo, bool, bool) {
+	logInfo, err := logParser.ParseLog(data)
+	if errors.Is(err, parser.ErrSkipLine) {
+		return nil, false, false
+	} else if err != nil {
+		loganalyzer.rejecter.reject(logFile, lineNo, offset, data, err)
+		return nil, false, false
+	}
+	if logInfo.Time.IsZero() && (!loganalyzer.since.IsZero() || !loganalyzer.util.IsZero()) {
+		loganalyzer.rejecter.reject(logFile, lineNo, offset, data, errors.New("no time to filter by -ta and -tb"))
+		return nil, false, false
+	}
 	skipAble := isDateSkipAble(loganalyzer, logInfo)
 	if skipAble {
-		return
+		late := !loganalyzer.util.IsZero() && logInfo.Time.After(loganalyzer.util)
+		return nil, late, isPastTolerance(loganalyzer, logInfo)
 	}
-	loganalyzer.handler.Input(logInfo)
+	return logInfo, false, false
 }
 
-func generator(tokens chan<- []byte, logFile string) {
-	file, isGzip := ioutil.OpenFile(logFile)
-	reader, err := ioutil.ReadFile(file, isGzip)
-	if err != nil {
-		ioutil.Fatal(err.Error())
+// minChunkSize is the minimum size of the chunks of a plain file read in parallel, smaller
+// files are read sequentially.
+const minChunkSize = 4 * 1024 * 1024
+
+func testProcess(logFiles []string, loganalyzer *loganalyzer) {
+	start := time.Now()
+	var (
+		wg sync.WaitGroup
+		// rotated logs are processed concurrently, and the members of each log in order
+		tokens = make(chan struct{}, workers)
+	)
+	loganalyzer.pool = newWorkerPool(loganalyzer, workers)
+	for _, group := range rotationGroups(logFiles) {
+		group := group
+		wg.Add(1)
+		tokens <- struct{}{} // acquire a token
+		go func() {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			for i, logFile := range group {
+				if processLog(loganalyzer, logFile) {
+					// the later rotated members are even newer
+					for _, skipped := range group[i+1:] {
+						_, _ = fmt.Fprintf(os.Stderr, "skip %v: past the end time\n", skipped)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	loganalyzer.pool.close()
+	// 5. print result
+	loganalyzer.handler.Output(limit)
+	if loganalyzer.incremental != nil {
+		if err := loganalyzer.incremental.save(loganalyzer.handler); err != nil {
+			ioutil.Fatal("save incremental state error: %v\n", err.Error())
+			return
+		}
+	}
+	closeLogAnalyzer(loganalyzer)
+	fmt.Printf("%s took %v\n", "job", time.Since(start))
+}
+
+// rotationGroups groups the consecutive log files by the logs they are rotated from.
+func rotationGroups(logFiles []string) [][]string {
+	var groups [][]string
+	for i, logFile := range logFiles {
+		if i > 0 && ioutil.RotationName(logFile) == ioutil.RotationName(logFiles[i-1]) {
+			groups[len(groups)-1] = append(groups[len(groups)-1], logFile)
+		} else {
+			groups = append(groups, []string{logFile})
+		}
 	}
+	return groups
+}
+
+// processLog analyzes the log file, and returns true if the file is past the end time, then
+// its later rotated members are past the end time too.
+func processLog(loganalyzer *loganalyzer, logFile string) bool {
+	if loganalyzer.incremental != nil && (logFile == ioutil.Stdin || ioutil.IsURL(logFile)) {
+		_, _ = fmt.Fprintf(os.Stderr, "skip %v: only local files are analyzed in '-incremental' mode\n", logFile)
+		return false
+	}
+	logParser := loganalyzer.parserOf(logFile)
+	// 1. open and read file
+	file := openLog(logFile)
 	defer func() {
-		err := file.Close()
-		if err != nil {
+		// 5. close file handler, the standard input may be read more than once
+		if logFile == ioutil.Stdin {
+			return
+		}
+		if err := file.Close(); err != nil {
 			ioutil.Fatal("close file error: %v\n", err.Error())
 		}
-		close(tokens)
 	}()
+	reader, err := ioutil.ReadFile(file)
+	if err != nil {
+		ioutil.Fatal("read file error: %v\n", err.Error())
+		return false
+	}
+	if logParser == nil {
+		logParser = detectLogParser(logFile, reader)
+	}
+	var cp *checkpoint
+	if loganalyzer.incremental != nil {
+		// recorded before the file is skipped, otherwise it is read again by the next run
+		cp = loganalyzer.incremental.resume(logFile, file.(*os.File), reader)
+	}
+	if logFile != ioutil.Stdin && isPastEnd(loganalyzer, logParser, reader) {
+		_, _ = fmt.Fprintf(os.Stderr, "skip %v: past the end time\n", logFile)
+		return true
+	}
+	stateful, isStateful := logParser.(parser.StatefulParser)
+	// the offset of the reader in the content, and the bytes before skip are parsed only for
+	// the state of the stateful parser, e.g. the "#Fields" directive
+	var offset, skip int64
+	if cp != nil {
+		if cp.Offset > 0 && isStateful {
+			skip = cp.Offset
+		} else if cp.Offset > 0 {
+			if err := ioutil.Skip(file.(*os.File), reader, cp.Offset); err != nil {
+				ioutil.Fatal("resume %v error: %v\n", logFile, err.Error())
+				return false
+			}
+			offset = cp.Offset
+		}
+		if cp.Offset > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "resume %v from offset %v, the line numbers are counted from it\n", logFile, cp.Offset)
+		}
+	}
+	if offset == 0 && skip == 0 {
+		if offset = seekStart(loganalyzer, logParser, logFile, file); offset > 0 {
+			reader.Reset(file)
+		}
+	}
+	// the lines are parsed in order if they depend on the former lines, or in '-incremental'
+	// mode with the end time, where the checkpoint stops at the first line after the end time
+	// and none of the later lines are handled, they are analyzed by the next run
+	stopLate := cp != nil && !loganalyzer.util.IsZero()
+	ordered := isStateful || stopLate
+	if f, ok := file.(*os.File); ok && logFile != ioutil.Stdin && !ordered && ioutil.IsPlainFile(f) {
+		return readChunks(loganalyzer, logParser, logFile, f, offset, cp)
+	}
+	if isStateful {
+		stateful.Reset()
+	}
 
-	for {
+	var (
+		// the rest lines of the file are past the end time, except the standard input
+		// which may be concatenated from unordered files
+		past    atomic.Bool
+		batcher = loganalyzer.pool.batcher(logFile, logParser, &past)
+	)
+	for lineNo := 1; ; lineNo++ {
+		if past.Load() && logFile != ioutil.Stdin {
+			break
+		}
 		data, err := reader.ReadBytes('\n')
+		if err == io.EOF && cp != nil && len(data) > 0 {
+			// the incomplete last line is analyzed in the next run
+			break
+		}
+		offset += int64(len(data))
+		if offset <= skip && len(data) > 0 {
+			_, _ = logParser.ParseLog(data)
+			lineNo--
+			continue
+		}
+		if len(data) > 0 && ordered {
+			logInfo, isLate, isPast := parseLine(loganalyzer, logParser, logFile, lineNo, offset-int64(len(data)), data)
+			if isLate && stopLate {
+				offset -= int64(len(data))
+				past.Store(true)
+				break
+			}
+			if logInfo != nil {
+				loganalyzer.handler.Input(logInfo)
+			}
+			if isPast {
+				past.Store(true)
+			}
+		} else if len(data) > 0 {
+			// 2. parse line, 3. datetime filter, 4. process data, by the workers
+			batcher.add(lineNo, offset-int64(len(data)), data)
+		}
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			break
+			ioutil.Fatal("read file error: %v\n", err.Error())
+			return false
 		}
-		tokens <- data // acquire a token
 	}
-
+	batcher.wait()
+	if cp != nil {
+		cp.Offset = offset
+	}
+	return past.Load() && logFile != ioutil.Stdin
 }
 
-func merge(loganalyzer *loganalyzer, data <-chan []byte, wg *sync.WaitGroup) {
-	for d := range data {
-		wg.Add(1)
-		go func(pLog []byte) {
-			defer wg.Done()
-			parseLog(loganalyzer, pLog)
-		}(d)
+// readChunks reads the plain file from the offset, in chunks aligned to lines, each chunk
+// is read by a goroutine and parsed by the workers. It returns true if the file is past the
+// end time.
+func readChunks(loganalyzer *loganalyzer, logParser parser.Parser, logFile string, file *os.File, offset int64, cp *checkpoint) bool {
+	info, err := file.Stat()
+	if err != nil {
+		ioutil.Fatal("stat file error: %v\n", err.Error())
+		return false
+	}
+	end := info.Size()
+	if cp != nil {
+		// the incomplete last line is analyzed in the next run
+		if end, err = ioutil.CompleteEnd(file, end); err != nil {
+			ioutil.Fatal("read file error: %v\n", err.Error())
+			return false
+		}
+	}
+	n := workers
+	if chunks := int((end - offset) / minChunkSize); chunks < n {
+		n = chunks
+	}
+	bounds, err := ioutil.SplitLines(file, offset, end, n)
+	if err != nil {
+		ioutil.Fatal("read file error: %v\n", err.Error())
+		return false
+	}
+	firstLines, err := chunkLines(file, bounds)
+	if err != nil {
+		ioutil.Fatal("read file error: %v\n", err.Error())
+		return false
 	}
-}
 
-func process(logFiles []string, loganalyzer *loganalyzer) {
-	start := time.Now()
 	var (
 		wg sync.WaitGroup
-		// tokens = make(chan []byte, 100000)
+		// the chunks past the end time, the later chunks are past the end time too
+		pasts = make([]atomic.Bool, len(bounds)-1)
 	)
-	for _, logFile := range logFiles {
-		tokens := make(chan []byte, 100000)
-		wg.Add(2)
+	pastChunk := func() int {
+		for i := range pasts {
+			if pasts[i].Load() {
+				return i
+			}
+		}
+		return len(pasts)
+	}
+	for i := range pasts {
+		i := i
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			generator(tokens, logFile)
+			section := io.NewSectionReader(file, bounds[i], bounds[i+1]-bounds[i])
+			reader := bufio.NewReaderSize(section, 64*1024)
+			batcher := loganalyzer.pool.batcher(logFile, logParser, &pasts[i])
+			defer batcher.wait()
+			pos := bounds[i]
+			for lineNo := firstLines[i]; ; lineNo++ {
+				if pastChunk() <= i {
+					return
+				}
+				data, err := reader.ReadBytes('\n')
+				if len(data) > 0 {
+					// 2. parse line, 3. datetime filter, 4. process data, by the workers
+					batcher.add(lineNo, pos, data)
+				}
+				pos += int64(len(data))
+				if err == io.EOF {
+					return
+				} else if err != nil {
+					ioutil.Fatal("read file error: %v\n", err.Error())
+					return
+				}
+			}
 		}()
+	}
+	wg.Wait()
+
+	if cp != nil {
+		// the chunks are read to the end without the end time, see processLog
+		cp.Offset = end
+	}
+	return pastChunk() < len(pasts)
+}
+
+// chunkLines returns the line numbers of the first lines of the chunks, the lines of the
+// chunks are counted concurrently.
+func chunkLines(file io.ReaderAt, bounds []int64) ([]int, error) {
+	var (
+		wg     sync.WaitGroup
+		counts = make([]int, len(bounds)-1)
+		errs   = make([]error, len(bounds)-1)
+	)
+	// the lines of the last chunk are not needed
+	for i := 0; i < len(bounds)-2; i++ {
+		i := i
+		wg.Add(1)
 		go func() {
-			defer func() {
-				wg.Done()
-			}()
-			merge(loganalyzer, tokens, &wg)
+			defer wg.Done()
+			counts[i], errs[i] = ioutil.CountLines(file, bounds[i], bounds[i+1])
 		}()
 	}
-	// 5. print result
 	wg.Wait()
-	// loganalyzer.handler.Output(limit)
-	fmt.Printf("%s took %v\n", "job", time.Since(start))
-}
 
-func testProcess(logFiles []string, loganalyzer *loganalyzer) {
-	start := time.Now()
-	var wg sync.WaitGroup
-	for _, logFile := range logFiles {
-		// 1. open and read file
-		file, isGzip := ioutil.OpenFile(logFile)
-		reader, err := ioutil.ReadFile(file, isGzip)
-		if err != nil {
-			ioutil.Fatal("read file error: %v\n", err.Error())
+	firstLines := make([]int, len(bounds)-1)
+	for i := range firstLines {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
-		for {
-
-			data, err := reader.ReadBytes('\n')
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				ioutil.Fatal("read file error: %v\n", err.Error())
-				return
-			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				// 2. parse line
-				logInfo := loganalyzer.parser.ParseLog(data)
-
-				// 3. datetime filter
-				if !loganalyzer.since.IsZero() || !loganalyzer.util.IsZero() {
-					logTime := parser.ParseTime(logInfo.TimeLocal)
-					if !loganalyzer.since.IsZero() && logTime.Before(loganalyzer.since) {
-						// go to next line
-						return
-					}
-					if !loganalyzer.util.IsZero() && logTime.After(loganalyzer.util) {
-						// go to next file
-						return
-					}
-				}
-				// 4. process data
-				loganalyzer.handler.Input(logInfo)
-			}()
+		firstLines[i] = 1
+		if i > 0 {
+			firstLines[i] = firstLines[i-1] + counts[i-1]
 		}
-		wg.Wait()
-		// 5. close file handler
-		err = file.Close()
-		if err != nil {
-			ioutil.Fatal("close file error: %v\n", err.Error())
+	}
+	return firstLines, nil
+}
+
+// closeLogAnalyzer releases the handler after the last output, and prints the summary of
+// rejected lines.
+func closeLogAnalyzer(loganalyzer *loganalyzer) {
+	if closer, ok := loganalyzer.handler.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			ioutil.Fatal("close handler error: %v\n", err.Error())
 			return
 		}
 	}
-	// 5. print result
-	// loganalyzer.handler.Output(limit)
-	fmt.Printf("%s took %v\n", "job", time.Since(start))
+	loganalyzer.rejecter.close(os.Stderr)
 }
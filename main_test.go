@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fantasticmao/nginx-log-analyzer/handler"
+	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var logStart = time.Date(2021, 11, 1, 0, 0, 0, 0, time.FixedZone("", 8*60*60))
+
+// logLines returns n combined lines, one line per second from the from-th second of logStart,
+// and every malformed-th line is malformed if malformed is positive.
+func logLines(from, n, malformed int) []byte {
+	var buf bytes.Buffer
+	for i := from; i < from+n; i++ {
+		if malformed > 0 && i%malformed == malformed-1 {
+			fmt.Fprintf(&buf, "malformed line %d\n", i)
+			continue
+		}
+		fmt.Fprintf(&buf, "192.168.1.%d - - [%v] \"GET /p/%d HTTP/1.1\" 200 100 \"-\" \"iOS\"\n",
+			i%250, logStart.Add(time.Duration(i)*time.Second).Format("02/Jan/2006:15:04:05 -0700"), i)
+	}
+	return buf.Bytes()
+}
+
+// writeLog writes the lines of logLines to the file.
+func writeLog(t *testing.T, file string, n, malformed int) []byte {
+	data := logLines(0, n, malformed)
+	assert.Nil(t, os.WriteFile(file, data, 0o644))
+	return data
+}
+
+// appendLog appends n lines from the from-th second to the file.
+func appendLog(t *testing.T, file string, from, n int) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	assert.Nil(t, err)
+	_, err = f.Write(logLines(from, n, 0))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestSeekStart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.log")
+	data := writeLog(t, file, 100000, 2)
+	loganalyzer := &loganalyzer{since: logStart.Add(50000 * time.Second)}
+	logParser := parser.NewCombinedParser()
+
+	f, err := os.Open(file)
+	assert.Nil(t, err)
+	defer f.Close()
+	// the malformed lines in the probed windows have no time
+	offset := seekStart(loganalyzer, logParser, file, f)
+	assert.Greater(t, offset, int64(0))
+	assert.True(t, data[offset-1] == '\n')
+	// the first line with time is not after the start time
+	for _, line := range bytes.SplitAfter(data[offset:], []byte("\n")) {
+		if logInfo, err := logParser.ParseLog(line); err == nil {
+			assert.False(t, logInfo.Time.After(loganalyzer.since))
+			break
+		}
+	}
+}
+
+// newTestAnalyzer returns a loganalyzer of the combined logs with its worker pool, which
+// counts PV and UV.
+func newTestAnalyzer(policy, quarantineFile string) *loganalyzer {
+	loganalyzer := &loganalyzer{
+		parser:   parser.NewCombinedParser(),
+		handler:  handler.NewPvAndUvHandler(),
+		rejecter: newRejecter(policy, quarantineFile),
+	}
+	loganalyzer.pool = newWorkerPool(loganalyzer, workers)
+	return loganalyzer
+}
+
+func TestReadChunksLineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log")
+	content := writeLog(t, file, 120000, 1000)
+	lines := strings.SplitAfter(string(content), "\n")
+	workers = 4
+
+	for _, from := range []int{0, 60000} {
+		// the offset of the from-th line
+		offset := int64(len(strings.Join(lines[:from], "")))
+		quarantineFile := filepath.Join(dir, fmt.Sprintf("rejected-%d.log", from))
+		loganalyzer := newTestAnalyzer(onErrorQuarantine, quarantineFile)
+
+		f, err := os.Open(file)
+		assert.Nil(t, err)
+		assert.True(t, ioutil.IsPlainFile(f))
+		assert.False(t, readChunks(loganalyzer, loganalyzer.parser, file, f, offset, nil))
+		assert.Nil(t, f.Close())
+		loganalyzer.pool.close()
+		loganalyzer.rejecter.close(io.Discard)
+
+		// the line numbers are counted from the offset, and the byte offsets from the
+		// beginning of the file
+		data, err := os.ReadFile(quarantineFile)
+		assert.Nil(t, err)
+		rejected := strings.SplitAfter(string(data), "\n")
+		rejected = rejected[:len(rejected)-1]
+		assert.Equal(t, (120000-from)/1000, len(rejected))
+		for _, reject := range rejected {
+			var (
+				lineNo     int
+				lineOffset int64
+			)
+			location, line, _ := strings.Cut(reject, ": ")
+			_, err := fmt.Sscanf(strings.TrimPrefix(location, file+":"), "%d (offset %d)", &lineNo, &lineOffset)
+			assert.Nil(t, err)
+			assert.Equal(t, lines[from+lineNo-1], line)
+			assert.Equal(t, line, string(content[lineOffset:lineOffset+int64(len(line))]))
+		}
+	}
+}
+
+func TestRotationGroups(t *testing.T) {
+	groups := rotationGroups([]string{"a.log.2.gz", "a.log.1", "a.log", "b.log", "-", "c.log-20211101", "c.log"})
+	assert.Equal(t, [][]string{{"a.log.2.gz", "a.log.1", "a.log"}, {"b.log"}, {"-"}, {"c.log-20211101", "c.log"}}, groups)
+}
+
+func TestChunkLines(t *testing.T) {
+	data := []byte("a\nbb\nccc\ndddd\neeeee\nffffff\n")
+	firstLines, err := chunkLines(bytes.NewReader(data), []int64{0, 9, 20, 27})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 4, 6}, firstLines)
+
+	firstLines, err = chunkLines(bytes.NewReader(data), []int64{5, 27})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, firstLines)
+}
+
+func TestDiscoverLogs(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "nginx.conf")
+	sharedFile, mainFile := filepath.Join(dir, "shared.log"), filepath.Join(dir, "main.log")
+	conf := `http {
+    log_format main '$remote_addr [$time_local] "$request" $status';
+    access_log ` + sharedFile + ` combined;
+    access_log ` + mainFile + ` main;
+    server {
+        access_log ` + sharedFile + ` main;
+    }
+}
+`
+	assert.Nil(t, os.WriteFile(confFile, []byte(conf), 0o644))
+	lines := "192.168.1.1 [01/Nov/2021:00:00:00 +0800] \"GET / HTTP/1.1\" 200\n"
+	assert.Nil(t, os.WriteFile(sharedFile, []byte(lines), 0o644))
+	assert.Nil(t, os.WriteFile(mainFile, []byte(lines), 0o644))
+
+	files, parsers := discoverLogs(confFile, nil)
+	assert.Equal(t, []string{sharedFile, mainFile}, files)
+	assert.NotNil(t, parsers[mainFile])
+	// the file written by both log_formats is analyzed once, with the detected parser
+	p, ok := parsers[sharedFile]
+	assert.True(t, ok)
+	assert.Nil(t, p)
+
+	f, err := os.Open(sharedFile)
+	assert.Nil(t, err)
+	defer f.Close()
+	logInfo, err := detectLogParser(sharedFile, bufio.NewReader(f)).ParseLog([]byte(lines))
+	assert.Nil(t, err)
+	assert.Equal(t, "/", logInfo.Path)
+	assert.Equal(t, 200, logInfo.Status)
+}
@@ -0,0 +1,193 @@
+package nginxconf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// LogFormatCombined is the name of the log_format predefined by nginx
+	LogFormatCombined = "combined"
+	combinedFormat    = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+)
+
+type (
+	// Config holds the log_format and access_log directives of a nginx configuration tree.
+	Config struct {
+		LogFormats map[string]LogFormat
+		AccessLogs []AccessLog
+	}
+	LogFormat struct {
+		Name   string
+		Escape string
+		Format string
+	}
+	AccessLog struct {
+		Path    string
+		Format  string
+		Context string // the innermost block of the directive: http, server or location
+	}
+	directive struct {
+		name string
+		args []string
+		file string
+		line int
+	}
+)
+
+// Load reads the nginx configuration file, follows its include directives, and collects
+// every log_format and access_log directive in the http, server and location contexts.
+func Load(path string) (*Config, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{
+		confDir: filepath.Dir(path),
+		prefix:  filepath.Dir(filepath.Dir(path)),
+		config: &Config{
+			LogFormats: map[string]LogFormat{
+				LogFormatCombined: {Name: LogFormatCombined, Format: combinedFormat},
+			},
+		},
+		included: make(map[string]bool),
+	}
+	if err = l.load(path, nil); err != nil {
+		return nil, err
+	}
+	for _, accessLog := range l.config.AccessLogs {
+		if _, ok := l.config.LogFormats[accessLog.Format]; !ok {
+			return nil, fmt.Errorf("access_log %v uses unknown log_format %v", accessLog.Path, accessLog.Format)
+		}
+	}
+	return l.config, nil
+}
+
+type loader struct {
+	confDir  string
+	prefix   string
+	config   *Config
+	included map[string]bool
+	seen     map[AccessLog]bool
+}
+
+func (l *loader) load(file string, contexts []string) error {
+	if l.included[file] {
+		return fmt.Errorf("recursive include of %v", file)
+	}
+	l.included[file] = true
+	defer delete(l.included, file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	s := &scanner{file: file, data: data, line: 1}
+	return l.block(s, contexts, false)
+}
+
+func (l *loader) block(s *scanner, contexts []string, nested bool) error {
+	for {
+		d, token, err := s.directive()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "":
+			if nested {
+				return fmt.Errorf("%v:%v: unexpected end of file, expecting \"}\"", s.file, s.line)
+			}
+			return nil
+		case "}":
+			if !nested {
+				return fmt.Errorf("%v:%v: unexpected \"}\"", s.file, s.line)
+			}
+			return nil
+		case "{":
+			if err = l.block(s, append(contexts, d.name), true); err != nil {
+				return err
+			}
+		case ";":
+			if err = l.handle(d, contexts); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (l *loader) handle(d *directive, contexts []string) error {
+	switch d.name {
+	case "include":
+		if len(d.args) != 1 {
+			return d.errorf("invalid number of arguments")
+		}
+		pattern := d.args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(l.confDir, pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return d.errorf(err.Error())
+		}
+		if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return d.errorf("open %v: no such file", pattern)
+		}
+		for _, file := range files {
+			if err = l.load(file, contexts); err != nil {
+				return err
+			}
+		}
+	case "log_format":
+		if !inHttp(contexts) {
+			return nil
+		}
+		if len(d.args) < 2 {
+			return d.errorf("invalid number of arguments")
+		}
+		logFormat := LogFormat{Name: d.args[0], Escape: "default"}
+		args := d.args[1:]
+		if strings.HasPrefix(args[0], "escape=") {
+			logFormat.Escape = strings.TrimPrefix(args[0], "escape=")
+			args = args[1:]
+		}
+		logFormat.Format = strings.Join(args, "")
+		l.config.LogFormats[logFormat.Name] = logFormat
+	case "access_log":
+		if !inHttp(contexts) || len(d.args) == 0 {
+			return nil
+		}
+		path := d.args[0]
+		if path == "off" || strings.HasPrefix(path, "syslog:") || strings.Contains(path, "$") {
+			// neither disabled nor remote logs nor per-request paths could be read from disk
+			return nil
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(l.prefix, path)
+		}
+		accessLog := AccessLog{Path: path, Format: LogFormatCombined, Context: contexts[len(contexts)-1]}
+		if len(d.args) > 1 && !strings.Contains(d.args[1], "=") {
+			accessLog.Format = d.args[1]
+		}
+		if l.seen == nil {
+			l.seen = make(map[AccessLog]bool)
+		}
+		key := AccessLog{Path: accessLog.Path, Format: accessLog.Format}
+		if !l.seen[key] {
+			l.seen[key] = true
+			l.config.AccessLogs = append(l.config.AccessLogs, accessLog)
+		}
+	}
+	return nil
+}
+
+// inHttp reports whether the contexts are nested in the http block, the stream block has
+// log_format and access_log directives too but with its own variables.
+func inHttp(contexts []string) bool {
+	return len(contexts) > 0 && contexts[0] == "http"
+}
+
+func (d *directive) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%v:%v: %v directive: %v", d.file, d.line, d.name, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,74 @@
+package nginxconf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	config, err := Load("../testdata/nginx/nginx.conf")
+	assert.Nil(t, err)
+	assert.NotNil(t, config)
+
+	assert.Len(t, config.LogFormats, 3)
+	assert.Equal(t, `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`,
+		config.LogFormats["main"].Format)
+	assert.Equal(t, "default", config.LogFormats["main"].Escape)
+	assert.Equal(t, `{"remote_addr":"$remote_addr","time_local":"$time_local","request":"$request","status":$status}`,
+		config.LogFormats["json_log"].Format)
+	assert.Equal(t, "json", config.LogFormats["json_log"].Escape)
+	assert.Equal(t, combinedFormat, config.LogFormats[LogFormatCombined].Format)
+
+	prefix, _ := filepath.Abs("../testdata")
+	assert.Equal(t, []AccessLog{
+		{Path: filepath.Join(prefix, "logs/access.log"), Format: "combined", Context: "http"},
+		{Path: "/var/log/nginx/main.log", Format: "main", Context: "http"},
+		{Path: "/var/log/nginx/example.json.log", Format: "json_log", Context: "server"},
+		{Path: "/var/log/nginx/api.log", Format: "main", Context: "location"},
+	}, config.AccessLogs)
+}
+
+func TestScanner(t *testing.T) {
+	s := &scanner{file: "test.conf", data: []byte(`log_format x '"$a"' "\"${b}\"";` + "\n}"), line: 1}
+	d, token, err := s.directive()
+	assert.Nil(t, err)
+	assert.Equal(t, ";", token)
+	assert.Equal(t, "log_format", d.name)
+	assert.Equal(t, []string{"x", `"$a"`, `"${b}"`}, d.args)
+
+	d, token, err = s.directive()
+	assert.Nil(t, err)
+	assert.Nil(t, d)
+	assert.Equal(t, "}", token)
+	assert.Equal(t, 2, s.line)
+}
+
+func TestLoadError(t *testing.T) {
+	_, err := Load("../testdata/nginx/not_exist.conf")
+	assert.NotNil(t, err)
+}
+
+func TestLoadSharedAccessLog(t *testing.T) {
+	dir := t.TempDir()
+	confFile, logFile := filepath.Join(dir, "nginx.conf"), filepath.Join(dir, "access.log")
+	conf := `http {
+    log_format main '$remote_addr [$time_local] "$request" $status';
+    access_log ` + logFile + ` combined;
+    server {
+        access_log ` + logFile + ` main;
+    }
+}
+`
+	assert.Nil(t, os.WriteFile(confFile, []byte(conf), 0o644))
+
+	// both directives are kept, the file is written by both log_formats
+	config, err := Load(confFile)
+	assert.Nil(t, err)
+	assert.Equal(t, []AccessLog{
+		{Path: logFile, Format: "combined", Context: "http"},
+		{Path: logFile, Format: "main", Context: "server"},
+	}, config.AccessLogs)
+}
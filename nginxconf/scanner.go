@@ -0,0 +1,128 @@
+package nginxconf
+
+import "fmt"
+
+type scanner struct {
+	file string
+	data []byte
+	pos  int
+	line int
+}
+
+// directive reads the next directive, which is terminated by ";" or "{", the returned
+// token is "" at the end of file and "}" at the end of a block.
+func (s *scanner) directive() (*directive, string, error) {
+	var d *directive
+	for {
+		token, quoted, err := s.token()
+		if err != nil {
+			return nil, "", err
+		}
+		if !quoted {
+			switch token {
+			case "":
+				if d != nil {
+					return nil, "", fmt.Errorf("%v:%v: unexpected end of file, expecting \";\" or \"}\"", s.file, s.line)
+				}
+				return nil, "", nil
+			case ";", "{":
+				if d == nil {
+					return nil, "", fmt.Errorf("%v:%v: unexpected %q", s.file, s.line, token)
+				}
+				return d, token, nil
+			case "}":
+				if d != nil {
+					return nil, "", fmt.Errorf("%v:%v: unexpected \"}\"", s.file, s.line)
+				}
+				return nil, token, nil
+			}
+		}
+		if d == nil {
+			d = &directive{name: token, file: s.file, line: s.line}
+		} else {
+			d.args = append(d.args, token)
+		}
+	}
+}
+
+// token reads the next word, quoted string or one of the special characters ";{}".
+func (s *scanner) token() (string, bool, error) {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		if c == '#' {
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			break
+		}
+		if c == '\n' {
+			s.line++
+		}
+		s.pos++
+	}
+	if s.pos == len(s.data) {
+		return "", false, nil
+	}
+
+	c := s.data[s.pos]
+	switch c {
+	case ';', '{', '}':
+		s.pos++
+		return string(c), false, nil
+	case '"', '\'':
+		s.pos++
+		var token []byte
+		for s.pos < len(s.data) {
+			b := s.data[s.pos]
+			s.pos++
+			switch {
+			case b == c:
+				return string(token), true, nil
+			case b == '\\' && s.pos < len(s.data):
+				next := s.data[s.pos]
+				s.pos++
+				switch next {
+				case '"', '\'', '\\':
+					token = append(token, next)
+				case 'n':
+					token = append(token, '\n')
+				case 't':
+					token = append(token, '\t')
+				case 'r':
+					token = append(token, '\r')
+				default:
+					token = append(token, b, next)
+				}
+			default:
+				if b == '\n' {
+					s.line++
+				}
+				token = append(token, b)
+			}
+		}
+		return "", false, fmt.Errorf("%v:%v: unexpected end of file, expecting %q", s.file, s.line, string(c))
+	default:
+		start := s.pos
+		for s.pos < len(s.data) {
+			b := s.data[s.pos]
+			if b == '{' && s.pos > start && s.data[s.pos-1] == '$' {
+				// ${variable}
+				for s.pos < len(s.data) && s.data[s.pos] != '}' {
+					s.pos++
+				}
+				if s.pos < len(s.data) {
+					s.pos++
+				}
+				continue
+			}
+			if b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == ';' || b == '{' || b == '}' {
+				break
+			}
+			s.pos++
+		}
+		return string(s.data[start:s.pos]), false, nil
+	}
+}
@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apacheDirectives maps the directives of Apache mod_log_config to nginx variables, see
+// https://httpd.apache.org/docs/current/mod/mod_log_config.html#formats
+var apacheDirectives = map[byte]string{
+	'a': "remote_addr",
+	'h': "remote_addr",
+	'A': "server_addr",
+	'l': "remote_logname",
+	'u': "remote_user",
+	'r': "request",
+	's': "status",
+	'b': "body_bytes_sent",
+	'B': "body_bytes_sent",
+	'v': "server_name",
+	'V': "host",
+	'm': "request_method",
+	'U': "uri",
+	'H': "server_protocol",
+	'I': "request_length",
+	'O': "bytes_sent",
+	'p': "server_port",
+	'P': "pid",
+	'k': "keepalive_requests",
+	'X': "connection_status",
+	'L': "log_id",
+	'R': "handler",
+	'f': "request_filename",
+}
+
+// NewApacheLogFormatParser compiles an Apache LogFormat string, e.g.
+// '%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i" %D'.
+func NewApacheLogFormatParser(format string) (*LogFormatParser, error) {
+	builder := &logFormatBuilder{parser: &LogFormatParser{}}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			builder.literal = append(builder.literal, format[i])
+			continue
+		}
+		i++
+		// skip the modifiers, e.g. "%>s", "%400,501{User-agent}i"
+		for i < len(format) && strings.IndexByte("!<>,0123456789", format[i]) >= 0 {
+			i++
+		}
+		var arg string
+		if i < len(format) && format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %%{ in log format: %v", format)
+			}
+			arg, i = format[i+1:i+end], i+end+1
+		}
+		if i == len(format) {
+			return nil, fmt.Errorf("incomplete directive in log format: %v", format)
+		}
+
+		directive := format[i]
+		if directive == '%' {
+			builder.literal = append(builder.literal, '%')
+			continue
+		}
+		name, set, err := apacheDirective(directive, arg)
+		if err != nil {
+			return nil, err
+		}
+		if directive == 'U' && strings.HasPrefix(format[i+1:], "%q") {
+			// "%U%q" is the path with the query string, which are not separated
+			name, set, i = "request_uri", variableSetters["request_uri"], i+2
+		}
+		if directive == 't' && arg == "" {
+			// %t is "[10/Oct/2000:13:55:36 -0700]"
+			builder.literal = append(builder.literal, '[')
+			if err = builder.variable(name, set); err != nil {
+				return nil, err
+			}
+			builder.literal = append(builder.literal, ']')
+			continue
+		}
+		if err = builder.variable(name, set); err != nil {
+			return nil, err
+		}
+		if directive == 't' && strings.Contains(arg, "%") {
+			// the value may contain the suffix, e.g. the space of "%{%Y-%m-%d %H:%M:%S}t"
+			builder.parser.fields[len(builder.parser.fields)-1].samples = strftimeSamples(arg)
+		}
+	}
+	parser, err := builder.build(format)
+	if err != nil {
+		return nil, err
+	}
+	// Apache escapes quotes, backslashes and non-printable bytes like the default mode of nginx
+	parser.unescape = unescapeDefault
+	return parser, nil
+}
+
+// apacheDirective returns the nginx variable name and the setter of a directive, the argument
+// is the text in the braces of "%{...}x".
+func apacheDirective(directive byte, arg string) (string, variableSetter, error) {
+	switch directive {
+	case 't':
+		return apacheTime(arg)
+	case 'D':
+		return apacheDuration("us")
+	case 'T':
+		return apacheDuration(arg)
+	case 'q':
+		return "args", func(info *LogInfo, value string) error {
+			info.Query = strings.TrimPrefix(value, "?")
+			return nil
+		}, nil
+	case 'i', 'o', 'e', 'n', 'C':
+		if arg == "" {
+			return "", nil, fmt.Errorf("directive %%%c needs an argument", directive)
+		}
+		name := strings.ToLower(strings.ReplaceAll(arg, "-", "_"))
+		switch directive {
+		case 'i':
+			name = "http_" + name
+		case 'o':
+			name = "sent_http_" + name
+		case 'C':
+			name = "cookie_" + name
+		}
+		return name, setterOf(name), nil
+	}
+	name, ok := apacheDirectives[directive]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported directive: %%%c", directive)
+	}
+	return name, setterOf(name), nil
+}
+
+// apacheTime returns the setter of "%t" or "%{format}t", the format is a strftime format or
+// one of sec, msec and usec, and may be prefixed by "begin:" or "end:".
+func apacheTime(arg string) (string, variableSetter, error) {
+	arg = strings.TrimPrefix(strings.TrimPrefix(arg, "begin:"), "end:")
+	var unit time.Duration
+	switch arg {
+	case "":
+		return "time_local", variableSetters["time_local"], nil
+	case "sec":
+		unit = time.Second
+	case "msec":
+		unit = time.Millisecond
+	case "usec":
+		unit = time.Microsecond
+	case "msec_frac", "usec_frac":
+		return arg, fieldSetter(arg), nil
+	default:
+		layout, err := strftimeLayout(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		return "time", func(info *LogInfo, value string) (err error) {
+			// the time without %z is in the local time zone, as Apache writes it
+			info.Time, err = time.ParseInLocation(layout, value, time.Local)
+			return
+		}, nil
+	}
+	return "time", func(info *LogInfo, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		info.Time = time.Unix(0, n*int64(unit))
+		return nil
+	}, nil
+}
+
+// apacheDuration returns the setter of "%T" or "%{UNIT}T", the unit is s by default.
+func apacheDuration(unit string) (string, variableSetter, error) {
+	switch unit {
+	case "", "s":
+		return "request_time", variableSetters["request_time"], nil
+	case "ms":
+		return "request_time", func(info *LogInfo, value string) (err error) { info.RequestTime, err = msToSeconds(value); return }, nil
+	case "us":
+		return "request_time", func(info *LogInfo, value string) (err error) { info.RequestTime, err = usToSeconds(value); return }, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported unit of %%T: %v", unit)
+	}
+}
+
+// strftimeSamples returns the values of the strftime format at two times, whose values differ
+// in padding, e.g. the days padded with spaces by %e.
+func strftimeSamples(format string) []string {
+	layout, err := strftimeLayout(strings.TrimPrefix(strings.TrimPrefix(format, "begin:"), "end:"))
+	if err != nil {
+		return nil
+	}
+	return []string{
+		time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC).Format(layout),
+		time.Date(2021, 11, 22, 13, 14, 15, 0, time.UTC).Format(layout),
+	}
+}
+
+// strftimeLayouts maps the strftime conversions to the Go layouts.
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03", 'M': "04",
+	'S': "05", 'p': "PM", 'b': "Jan", 'h': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'z': "-0700", 'Z': "MST", 'T': "15:04:05", 'F': "2006-01-02", 'D': "01/02/06", '%': "%",
+}
+
+// strftimeLayout converts a strftime format to a Go time layout.
+func strftimeLayout(format string) (string, error) {
+	var layout strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			layout.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return "", errors.New("incomplete strftime format: " + format)
+		}
+		i++
+		s, ok := strftimeLayouts[format[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported strftime conversion %%%c in: %v", format[i], format)
+		}
+		layout.WriteString(s)
+	}
+	return layout.String(), nil
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// albColumns are the fields of Application Load Balancer access logs, see
+	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+	albColumns = []string{
+		"type", "time", "elb", "client:port", "target:port",
+		"request_processing_time", "target_processing_time", "response_processing_time",
+		"elb_status_code", "target_status_code", "received_bytes", "sent_bytes",
+		"request", "user_agent", "ssl_cipher", "ssl_protocol", "target_group_arn", "trace_id",
+		"domain_name", "chosen_cert_arn", "matched_rule_priority", "request_creation_time",
+		"actions_executed", "redirect_url", "error_reason", "target:port_list",
+		"target_status_code_list", "classification", "classification_reason",
+	}
+	// elbColumns are the fields of Classic Load Balancer access logs, see
+	// https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+	elbColumns = []string{
+		"timestamp", "elb", "client:port", "backend:port",
+		"request_processing_time", "backend_processing_time", "response_processing_time",
+		"elb_status_code", "backend_status_code", "received_bytes", "sent_bytes",
+		"request", "user_agent", "ssl_cipher", "ssl_protocol",
+	}
+
+	// awsSetters maps the fields of ALB and ELB access logs, the request time is the sum of
+	// the processing times, which are in seconds and -1 if the request could not be dispatched.
+	awsSetters = map[string]variableSetter{
+		"time":      func(info *LogInfo, value string) (err error) { info.Time, err = ParseTime(value); return },
+		"timestamp": func(info *LogInfo, value string) (err error) { info.Time, err = ParseTime(value); return },
+		"client:port": func(info *LogInfo, value string) error {
+			info.RemoteAddr = trimPort(value)
+			return nil
+		},
+		"target:port":              setUpstreamAddr,
+		"backend:port":             setUpstreamAddr,
+		"request_processing_time":  addRequestTime,
+		"target_processing_time":   addUpstreamTime,
+		"backend_processing_time":  addUpstreamTime,
+		"response_processing_time": addRequestTime,
+		"elb_status_code":          variableSetters["status"],
+		"target_status_code":       variableSetters["upstream_status"],
+		"backend_status_code":      variableSetters["upstream_status"],
+		"received_bytes":           variableSetters["request_length"],
+		"sent_bytes":               variableSetters["body_bytes_sent"],
+		"request":                  variableSetters["request"],
+		"user_agent":               variableSetters["http_user_agent"],
+		"ssl_cipher":               variableSetters["ssl_cipher"],
+		"ssl_protocol":             variableSetters["ssl_protocol"],
+		"domain_name":              variableSetters["server_name"],
+	}
+)
+
+type (
+	// ColumnsParser parses logs whose fields are separated by spaces, and may be quoted by
+	// double quotes, the meaning of fields is given by their columns.
+	ColumnsParser struct {
+		name      string
+		columns   []string
+		minFields int // ALB appends new fields over time, old logs have less fields
+		setters   map[string]variableSetter
+	}
+)
+
+// NewALBParser returns a parser of AWS Application Load Balancer access logs, e.g.
+// https 2018-07-02T22:23:00.186641Z app/my-lb/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 200 0 57 "GET https://www.example.com:443/ HTTP/1.1" "curl/7.46.0" ...
+func NewALBParser() *ColumnsParser {
+	return &ColumnsParser{name: "alb", columns: albColumns, minFields: 18, setters: awsSetters}
+}
+
+// NewELBParser returns a parser of AWS Classic Load Balancer access logs, e.g.
+// 2015-05-13T23:39:43.945958Z my-lb 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -
+func NewELBParser() *ColumnsParser {
+	return &ColumnsParser{name: "elb", columns: elbColumns, minFields: len(elbColumns), setters: awsSetters}
+}
+
+func (parser *ColumnsParser) ParseLog(line []byte) (*LogInfo, error) {
+	values, err := splitFields(bytes.TrimRight(line, "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("parse %v log error: %v", parser.name, err.Error())
+	}
+	if len(values) < parser.minFields {
+		return nil, fmt.Errorf("parse %v log error: expected %v fields, got %v", parser.name, parser.minFields, len(values))
+	}
+
+	logInfo := &LogInfo{}
+	if err = setColumns(logInfo, parser.columns, values, parser.setters); err != nil {
+		return nil, fmt.Errorf("parse %v log error: %v", parser.name, err.Error())
+	}
+	if logInfo.Time.IsZero() {
+		return nil, fmt.Errorf("parse %v log error: no time", parser.name)
+	}
+	return logInfo, nil
+}
+
+// setColumns sets the values by the setters of their columns, the values of columns which have
+// no setter are captured in LogInfo.Fields.
+func setColumns(info *LogInfo, columns, values []string, setters map[string]variableSetter) error {
+	for i, value := range values {
+		if i >= len(columns) {
+			break
+		}
+		if setter, ok := setters[columns[i]]; ok {
+			if err := setter(info, value); err != nil {
+				return fmt.Errorf("convert %v error: %v", columns[i], err.Error())
+			}
+		} else {
+			info.setField(columns[i], value)
+		}
+	}
+	return nil
+}
+
+// splitFields splits the line by spaces, fields quoted by double quotes may contain spaces
+// and escaped quotes.
+func splitFields(line []byte) ([]string, error) {
+	fields := make([]string, 0, 32)
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		if line[i] != '"' {
+			j := bytes.IndexByte(line[i:], ' ')
+			if j < 0 {
+				j = len(line) - i
+			}
+			fields = append(fields, string(line[i:i+j]))
+			i += j
+			continue
+		}
+
+		var field []byte
+		j := i + 1
+		for ; j < len(line) && line[j] != '"'; j++ {
+			if line[j] == '\\' && j+1 < len(line) {
+				j++
+			}
+			field = append(field, line[j])
+		}
+		if j == len(line) {
+			return nil, errors.New("unterminated quoted field")
+		}
+		fields = append(fields, string(field))
+		i = j + 1
+	}
+	return fields, nil
+}
+
+// trimPort removes the port of "ip:port", and returns "-" as is.
+func trimPort(value string) string {
+	if i := strings.LastIndexByte(value, ':'); i >= 0 {
+		return strings.Trim(value[:i], "[]")
+	}
+	return value
+}
+
+func setUpstreamAddr(info *LogInfo, value string) error {
+	info.UpstreamAddr = value
+	return nil
+}
+
+func addRequestTime(info *LogInfo, value string) error {
+	f, err := atof(value)
+	if err == nil && f > 0 {
+		info.RequestTime += f
+	}
+	return err
+}
+
+func addUpstreamTime(info *LogInfo, value string) error {
+	f, err := atof(value)
+	if err == nil && f > 0 {
+		info.RequestTime += f
+		info.UpstreamResponseTime = f
+	}
+	return err
+}
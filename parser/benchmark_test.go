@@ -15,3 +15,16 @@ func BenchmarkCombinedParser(b *testing.B) {
 		p.ParseLog(combinedLog)
 	}
 }
+
+func BenchmarkLogFormatParser(b *testing.B) {
+	p, _ := NewLogFormatParser(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`)
+	for i := 0; i < b.N; i++ {
+		p.ParseLog(combinedLog)
+	}
+}
+
+func BenchmarkParseTime(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = ParseTime("01/Nov/2021:00:00:00 +0800")
+	}
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// CaddyParser parses the JSON access logs of Caddy 2, e.g.
+	// {"ts":1646861401.52,"logger":"http.log.access","request":{"method":"GET",...},"duration":0.0009,"size":10900,"status":200}
+	CaddyParser struct {
+	}
+	caddyAccessLog struct {
+		Ts      json.RawMessage `json:"ts"`
+		Request struct {
+			RemoteIp string              `json:"remote_ip"`
+			ClientIp string              `json:"client_ip"`
+			Proto    string              `json:"proto"`
+			Method   string              `json:"method"`
+			Host     string              `json:"host"`
+			Uri      string              `json:"uri"`
+			Headers  map[string][]string `json:"headers"`
+			Tls      *struct {
+				Version     uint16 `json:"version"`
+				CipherSuite uint16 `json:"cipher_suite"`
+				ServerName  string `json:"server_name"`
+			} `json:"tls"`
+		} `json:"request"`
+		BytesRead int             `json:"bytes_read"`
+		UserId    string          `json:"user_id"`
+		Duration  json.RawMessage `json:"duration"`
+		Size      int             `json:"size"`
+		Status    int             `json:"status"`
+	}
+)
+
+func NewCaddyParser() *CaddyParser {
+	return &CaddyParser{}
+}
+
+func (parser *CaddyParser) ParseLog(line []byte) (*LogInfo, error) {
+	var log caddyAccessLog
+	if err := json.Unmarshal(bytes.TrimRight(line, "\r\n"), &log); err != nil {
+		return nil, fmt.Errorf("parse caddy log error: %v", err.Error())
+	}
+	if log.Request.Method == "" || log.Status == 0 {
+		return nil, errors.New("parse caddy log error: not an access log")
+	}
+
+	t, err := caddyTime(log.Ts)
+	if err != nil {
+		return nil, fmt.Errorf("convert ts error: %v", err.Error())
+	}
+	duration, err := caddyDuration(log.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("convert duration error: %v", err.Error())
+	}
+	headers := http.Header(log.Request.Headers)
+	logInfo := &LogInfo{
+		RemoteAddr:        log.Request.ClientIp,
+		RemoteUser:        log.UserId,
+		Time:              t,
+		Status:            log.Status,
+		BodyBytesSent:     log.Size,
+		HttpReferer:       headers.Get("Referer"),
+		HttpUserAgent:     headers.Get("User-Agent"),
+		RequestTime:       duration,
+		Host:              log.Request.Host,
+		RequestLength:     log.BytesRead,
+		HttpXForwardedFor: headers.Get("X-Forwarded-For"),
+	}
+	if logInfo.RemoteAddr == "" {
+		logInfo.RemoteAddr = log.Request.RemoteIp
+	}
+	if log.Request.Tls != nil {
+		logInfo.ServerName = log.Request.Tls.ServerName
+		logInfo.SslProtocol = strings.Replace(tls.VersionName(log.Request.Tls.Version), "TLS 1.", "TLSv1.", 1)
+		logInfo.SslCipher = tls.CipherSuiteName(log.Request.Tls.CipherSuite)
+	}
+	logInfo.setRequest(log.Request.Method + " " + log.Request.Uri + " " + log.Request.Proto)
+	return logInfo, nil
+}
+
+// caddyTime converts the ts field, which is a float of seconds since epoch by default, or a
+// string if the time_format of the log encoder is changed.
+func caddyTime(raw json.RawMessage) (time.Time, error) {
+	value, ok, err := jsonValue(raw)
+	if err != nil || !ok {
+		return time.Time{}, err
+	}
+	if len(raw) > 0 && raw[0] != '"' {
+		return ParseMsec(value)
+	}
+	return ParseTime(value)
+}
+
+// caddyDuration converts the duration field to seconds, which is a float of seconds by default,
+// or a string like "1.5ms" if the duration_format of the log encoder is "string".
+func caddyDuration(raw json.RawMessage) (float64, error) {
+	value, ok, err := jsonValue(raw)
+	if err != nil || !ok {
+		return 0, err
+	}
+	if len(raw) > 0 && raw[0] != '"' {
+		return strconv.ParseFloat(value, 64)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
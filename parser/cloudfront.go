@@ -0,0 +1,53 @@
+package parser
+
+import "net/url"
+
+var (
+	// cloudFrontColumns are the columns of CloudFront standard logs, see
+	// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/AccessLogs.html
+	cloudFrontColumns = []string{
+		"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)",
+		"cs-uri-stem", "sc-status", "cs(Referer)", "cs(User-Agent)", "cs-uri-query", "cs(Cookie)",
+		"x-edge-result-type", "x-edge-request-id", "x-host-header", "cs-protocol", "cs-bytes",
+		"time-taken", "x-forwarded-for", "ssl-protocol", "ssl-cipher", "x-edge-response-result-type",
+		"cs-protocol-version", "fle-status", "fle-encrypted-fields", "c-port", "time-to-first-byte",
+		"x-edge-detailed-result-type", "sc-content-type", "sc-content-len", "sc-range-start", "sc-range-end",
+	}
+
+	// cloudFrontSetters maps the columns of CloudFront logs, the values are URL encoded.
+	cloudFrontSetters = mergeSetters(w3cSetters, map[string]variableSetter{
+		"cs-protocol-version": variableSetters["server_protocol"],
+		"cs(Referer)": func(info *LogInfo, value string) error {
+			info.HttpReferer = unescapeURL(value)
+			return nil
+		},
+		"cs(User-Agent)": func(info *LogInfo, value string) error {
+			info.HttpUserAgent = unescapeURL(value)
+			return nil
+		},
+		"x-host-header":      variableSetters["host"],
+		"x-edge-result-type": variableSetters["upstream_cache_status"],
+		"ssl-protocol":       variableSetters["ssl_protocol"],
+		"ssl-cipher":         variableSetters["ssl_cipher"],
+	})
+)
+
+// NewCloudFrontParser returns a parser of CloudFront standard logs, whose values are separated
+// by tabs, the default columns are used until a "#Fields" directive is read.
+func NewCloudFrontParser() *W3CParser {
+	return &W3CParser{
+		name:      "cloudfront",
+		separator: "\t",
+		defaults:  cloudFrontColumns,
+		setters:   cloudFrontSetters,
+		columns:   cloudFrontColumns,
+	}
+}
+
+// unescapeURL decodes the URL encoded value, the value is kept as is if it is malformed.
+func unescapeURL(value string) string {
+	if s, err := url.PathUnescape(value); err == nil {
+		return s
+	}
+	return value
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+type (
+	// CSVParser parses CSV or TSV logs, the columns are named by the header row unless they are
+	// given, and mapped by the field mapping. Quoted CSV values could not span several lines.
+	CSVParser struct {
+		name    string
+		comma   rune
+		mapping *FieldMapping
+		header  []string // the given columns, the first line is the header row if it is empty
+
+		columns []string
+	}
+)
+
+// NewCSVParser returns a parser of CSV logs, the columns are named by the header row if the
+// given columns are empty.
+func NewCSVParser(mapping *FieldMapping, columns []string) *CSVParser {
+	return &CSVParser{name: "csv", comma: ',', mapping: mapping, header: columns, columns: columns}
+}
+
+// NewTSVParser returns a parser of TSV logs, whose values are separated by tabs and never quoted.
+func NewTSVParser(mapping *FieldMapping, columns []string) *CSVParser {
+	return &CSVParser{name: "tsv", comma: '\t', mapping: mapping, header: columns, columns: columns}
+}
+
+func (parser *CSVParser) Reset() {
+	parser.columns = parser.header
+}
+
+func (parser *CSVParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, ErrSkipLine
+	}
+	values, err := parser.split(line)
+	if err != nil {
+		return nil, fmt.Errorf("parse %v log error: %v", parser.name, err.Error())
+	}
+	if len(parser.columns) == 0 {
+		parser.columns = values
+		return nil, ErrSkipLine
+	}
+	if len(values) != len(parser.columns) {
+		return nil, fmt.Errorf("parse %v log error: expected %v fields, got %v", parser.name, len(parser.columns), len(values))
+	}
+
+	logInfo := &LogInfo{}
+	for i, value := range values {
+		if err = parser.mapping.set(logInfo, parser.columns[i], value); err != nil {
+			return nil, err
+		}
+	}
+	return logInfo, nil
+}
+
+func (parser *CSVParser) split(line []byte) ([]string, error) {
+	if parser.comma == '\t' {
+		return strings.Split(string(line), "\t"), nil
+	}
+	reader := csv.NewReader(bytes.NewReader(line))
+	reader.Comma = parser.comma
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
@@ -0,0 +1,93 @@
+package parser
+
+// Candidate is a log format which could be detected by Detect.
+type Candidate struct {
+	Name string
+	// New returns a new parser of this format
+	New func() Parser
+}
+
+// candidates are ordered by priority, the former wins when several candidates match the
+// same number of lines, e.g. combined logs are also valid Apache and NCSA logs.
+var candidates = []Candidate{
+	{
+		// Caddy and Traefik logs are also valid JSON logs
+		Name: LogFormatTypeCaddy,
+		New:  func() Parser { return NewCaddyParser() },
+	},
+	{
+		Name: LogFormatTypeTraefik,
+		New:  func() Parser { return NewTraefikParser() },
+	},
+	{
+		Name: LogFormatTypeJson,
+		New:  func() Parser { return NewJsonParser() },
+	},
+	{
+		Name: LogFormatTypeCombined,
+		New:  func() Parser { return NewCombinedParser() },
+	},
+	{
+		Name: LogFormatTypeApache,
+		New:  func() Parser { return NewCustomParserOf(ApacheFormatName) },
+	},
+	{
+		Name: LogFormatTypeNCSA,
+		New:  func() Parser { return NewCustomParserOf(NCSAFormatName) },
+	},
+	{
+		Name: LogFormatTypeIIS,
+		New:  func() Parser { return NewCustomParserOf(IISFormatName) },
+	},
+	{
+		Name: LogFormatTypeHAProxy,
+		New:  func() Parser { return NewHAProxyParser() },
+	},
+	{
+		Name: LogFormatTypeEnvoy,
+		New:  func() Parser { return NewEnvoyParser() },
+	},
+	{
+		Name: LogFormatTypeALB,
+		New:  func() Parser { return NewALBParser() },
+	},
+	{
+		Name: LogFormatTypeELB,
+		New:  func() Parser { return NewELBParser() },
+	},
+	{
+		// CloudFront logs are also valid W3C logs
+		Name: LogFormatTypeCF,
+		New:  func() Parser { return NewCloudFrontParser() },
+	},
+	{
+		Name: LogFormatTypeW3C,
+		New:  func() Parser { return NewW3CParser() },
+	},
+	{
+		Name: LogFormatTypeError,
+		New:  func() Parser { return NewErrorLogParser() },
+	},
+}
+
+// RegisterCandidate adds a log format to Detect, with the lowest priority.
+func RegisterCandidate(candidate Candidate) {
+	candidates = append(candidates, candidate)
+}
+
+// Detect scores every candidate by the number of sampled lines it parses without error, and
+// returns the best one, ok is false if no candidate parses any line.
+func Detect(lines [][]byte) (candidate Candidate, matched int, ok bool) {
+	for _, c := range candidates {
+		p, n := c.New(), 0
+		for _, line := range lines {
+			if _, err := p.ParseLog(line); err == nil {
+				n++
+			}
+		}
+		if n > matched {
+			candidate, matched, ok = c, n, true
+		}
+	}
+	return candidate, matched, ok
+}
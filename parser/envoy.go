@@ -0,0 +1,41 @@
+package parser
+
+import "strings"
+
+// EnvoyFormat is the default format of Envoy access logs, written by the template syntax of
+// nginx log_format, with the command operators renamed to variables.
+const EnvoyFormat = `[$start_time] "$request" $response_code $response_flags $bytes_received $bytes_sent ` +
+	`$duration $upstream_service_time "$x_forwarded_for" "$user_agent" "$request_id" "$authority" "$upstream_host"`
+
+// envoySetters maps the command operators of the default Envoy format, durations are in milliseconds.
+var envoySetters = map[string]variableSetter{
+	"start_time":     variableSetters["time_iso8601"],
+	"request":        variableSetters["request"],
+	"response_code":  variableSetters["status"],
+	"bytes_received": variableSetters["request_length"],
+	"bytes_sent":     variableSetters["body_bytes_sent"],
+	"duration":       func(info *LogInfo, value string) (err error) { info.RequestTime, err = msToSeconds(value); return },
+	"upstream_service_time": func(info *LogInfo, value string) (err error) {
+		info.UpstreamResponseTime, err = msToSeconds(value)
+		return
+	},
+	"x_forwarded_for": func(info *LogInfo, value string) error {
+		// the default format has no downstream address, the first hop of X-Forwarded-For is used
+		info.HttpXForwardedFor = value
+		info.RemoteAddr = strings.TrimSpace(strings.Split(value, ",")[0])
+		return nil
+	},
+	"user_agent":    variableSetters["http_user_agent"],
+	"authority":     variableSetters["host"],
+	"upstream_host": variableSetters["upstream_addr"],
+}
+
+// NewEnvoyParser returns a parser of the default Envoy access log format, e.g.
+// [2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"
+func NewEnvoyParser() *LogFormatParser {
+	parser, err := newLogFormatParser(EnvoyFormat, envoySetters)
+	if err != nil {
+		panic(err)
+	}
+	return parser
+}
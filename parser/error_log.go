@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ErrorLevels are the levels of nginx error logs, from the most severe one.
+var ErrorLevels = []string{"emerg", "alert", "crit", "error", "warn", "notice", "info", "debug"}
+
+// errorContextSetters maps the context which nginx appends to the messages of error logs.
+var errorContextSetters = map[string]variableSetter{
+	"client":   variableSetters["remote_addr"],
+	"server":   variableSetters["server_name"],
+	"request":  variableSetters["request"],
+	"upstream": variableSetters["upstream_addr"],
+	"host":     variableSetters["host"],
+	"referrer": variableSetters["http_referer"],
+}
+
+type (
+	// ErrorLogParser parses nginx error logs, e.g.
+	// 2023/10/31 19:07:45 [error] 1234#5678: *90 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 1.2.3.4, server: example.com, request: "GET /api HTTP/1.1", upstream: "http://10.0.0.1:8080/api", host: "example.com"
+	// the level, pid, tid, connection and message without the context are captured in LogInfo.Fields.
+	ErrorLogParser struct {
+	}
+)
+
+func NewErrorLogParser() *ErrorLogParser {
+	return &ErrorLogParser{}
+}
+
+func (parser *ErrorLogParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	// 2023/10/31 19:07:45 [error] 1234#5678: message
+	if len(line) < len(TimeErrorLogLayout)+3 || line[len(TimeErrorLogLayout)] != ' ' || line[len(TimeErrorLogLayout)+1] != '[' {
+		return nil, fmt.Errorf("parse error log error: %v", string(line))
+	}
+	t, err := timeErrorCache.parse(string(line[:len(TimeErrorLogLayout)]))
+	if err != nil {
+		return nil, fmt.Errorf("parse error log error: %v", err.Error())
+	}
+	rest := string(line[len(TimeErrorLogLayout)+2:])
+	level, rest, ok := strings.Cut(rest, "] ")
+	if !ok || !isErrorLevel(level) {
+		return nil, fmt.Errorf("parse error log error: %v", string(line))
+	}
+	process, message, ok := strings.Cut(rest, ": ")
+	pid, tid, _ := strings.Cut(process, "#")
+	if !ok || !isDigits(pid) || !isDigits(tid) {
+		return nil, fmt.Errorf("parse error log error: %v", string(line))
+	}
+
+	logInfo := &LogInfo{Time: t}
+	logInfo.setField("level", level)
+	logInfo.setField("pid", pid)
+	logInfo.setField("tid", tid)
+	if strings.HasPrefix(message, "*") {
+		if connection, msg, ok := strings.Cut(message[1:], " "); ok && isDigits(connection) {
+			logInfo.setField("connection", connection)
+			message = msg
+		}
+	}
+	if i := errorContextIndex(message); i >= 0 {
+		if err = setErrorContext(logInfo, message[i+2:]); err != nil {
+			return nil, fmt.Errorf("parse error log error: %v", err.Error())
+		}
+		message = message[:i]
+	}
+	logInfo.setField("message", message)
+	return logInfo, nil
+}
+
+// errorContextIndex returns the index of the context appended to the message, or -1.
+func errorContextIndex(message string) int {
+	for _, key := range []string{", client: ", ", server: "} {
+		if i := strings.Index(message, key); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// setErrorContext sets the context, e.g. `client: 1.2.3.4, server: example.com, request: "GET / HTTP/1.1"`,
+// the values of request, upstream, host and referrer are quoted.
+func setErrorContext(info *LogInfo, context string) error {
+	for context != "" {
+		key, rest, ok := strings.Cut(context, ": ")
+		if !ok {
+			return fmt.Errorf("malformed context: %v", context)
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return fmt.Errorf("unterminated value of %v: %v", key, rest)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if i := strings.Index(rest, ", "); i >= 0 {
+			value, rest = rest[:i], rest[i:]
+		} else {
+			value, rest = rest, ""
+		}
+		if set, ok := errorContextSetters[key]; ok {
+			if err := set(info, value); err != nil {
+				return fmt.Errorf("convert %v error: %v", key, err.Error())
+			}
+		} else {
+			info.setField(key, value)
+		}
+		context = strings.TrimPrefix(rest, ", ")
+	}
+	return nil
+}
+
+func isErrorLevel(level string) bool {
+	for _, l := range ErrorLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
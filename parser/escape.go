@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The escape modes of nginx log_format, see http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+const (
+	// EscapeDefault escapes `"`, `\` and the bytes out of 32-126 as \xXX
+	EscapeDefault = "default"
+	// EscapeJson escapes the characters which are not allowed in JSON strings
+	EscapeJson = "json"
+	// EscapeNone escapes nothing
+	EscapeNone = "none"
+)
+
+// unescaperOf returns the function which decodes the values of the escape mode, it is nil for
+// the none mode.
+func unescaperOf(escape string) (func(string) string, error) {
+	switch escape {
+	case EscapeDefault, "":
+		return unescapeDefault, nil
+	case EscapeJson:
+		return unescapeJson, nil
+	case EscapeNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported escape mode: %v", escape)
+	}
+}
+
+// unescapeDefault decodes the \xXX sequences of nginx, and the \" and \\ sequences of Apache,
+// e.g. `\xE4\xB8\xAD` is decoded to "中", malformed sequences are kept as is.
+func unescapeDefault(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'x':
+			if i+3 < len(s) {
+				if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 3
+					continue
+				}
+			}
+			b.WriteByte(s[i])
+		case '"', '\\':
+			b.WriteByte(s[i+1])
+			i++
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// unescapeJson decodes the escape sequences of JSON strings, malformed sequences are kept as is.
+func unescapeJson(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '"', '\\', '/':
+			b.WriteByte(s[i])
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			r, n := decodeJsonRune(s[i+1:])
+			if n == 0 {
+				b.WriteString(`\u`)
+				continue
+			}
+			b.WriteRune(r)
+			i += n
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// decodeJsonRune decodes the hex digits after \u, and the low surrogate after them if any, n is
+// the number of decoded bytes, or 0 if they are malformed.
+func decodeJsonRune(s string) (r rune, n int) {
+	if len(s) < 4 {
+		return 0, 0
+	}
+	c, err := strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, 0
+	}
+	r = rune(c)
+	if utf16.IsSurrogate(r) && len(s) >= 10 && s[4] == '\\' && s[5] == 'u' {
+		if c2, err := strconv.ParseUint(s[6:10], 16, 16); err == nil {
+			if pair := utf16.DecodeRune(r, rune(c2)); pair != utf8.RuneError {
+				return pair, 10
+			}
+		}
+	}
+	return r, 4
+}
+
+// indexUnescaped returns the index of the first sep which is not escaped by a backslash, or -1.
+func indexUnescaped(s, sep []byte) int {
+	for i := 0; i < len(s); {
+		j := bytes.Index(s[i:], sep)
+		if j < 0 {
+			return -1
+		}
+		// the sep is escaped if it is preceded by an odd number of backslashes
+		k := i + j
+		backslashes := 0
+		for k-backslashes > 0 && s[k-backslashes-1] == '\\' {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return i + j
+		}
+		i += j + 1
+	}
+	return -1
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// HAProxyFormat matches the HTTP log format of HAProxy ("option httplog"), the syslog header
+	// before the client address is ignored, e.g.
+	// haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"
+	HAProxyFormat = `(\S+):(\d+) \[(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2}\.\d{3})\] (\S+) ([^/\s]+)/(\S+) ` +
+		`(-?\d+)/(-?\d+)/(-?\d+)/(-?\d+)/\+?(-?\d+) (\d{3}|-1) \+?(\d+) (\S+) (\S+) (\S{4}) ` +
+		`(\d+)/(\d+)/(\d+)/(\d+)/\+?(\d+) (\d+)/(\d+)(?: \{([^}]*)\})?(?: \{([^}]*)\})? "(.*)"$`
+	haproxyTimeLayout = "02/Jan/2006:15:04:05.000"
+)
+
+var haproxyRegex = regexp.MustCompile(HAProxyFormat)
+
+// HAProxyParser parses the HTTP logs of HAProxy, timers are converted from milliseconds to seconds.
+type HAProxyParser struct {
+}
+
+func NewHAProxyParser() *HAProxyParser {
+	return &HAProxyParser{}
+}
+
+func (parser *HAProxyParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	matches := haproxyRegex.FindSubmatch(line)
+	if matches == nil {
+		return nil, fmt.Errorf("parse haproxy log error: %v", string(line))
+	}
+	m := make([]string, len(matches))
+	for i, match := range matches {
+		m[i] = string(match)
+	}
+
+	// the accept date has no time zone, it is the local time of the HAProxy host
+	t, err := time.ParseInLocation(haproxyTimeLayout, m[3], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("convert accept_date error: %v", err.Error())
+	}
+	status, err := atoi(m[12])
+	if err != nil {
+		return nil, fmt.Errorf("convert status_code error: %v", err.Error())
+	}
+	bytesRead, err := atoi(m[13])
+	if err != nil {
+		return nil, fmt.Errorf("convert bytes_read error: %v", err.Error())
+	}
+	// Tr is the response time of the server, and Ta is the total active time of the request
+	tr, err := msToSeconds(m[10])
+	if err != nil {
+		return nil, fmt.Errorf("convert Tr error: %v", err.Error())
+	}
+	ta, err := msToSeconds(m[11])
+	if err != nil {
+		return nil, fmt.Errorf("convert Ta error: %v", err.Error())
+	}
+
+	logInfo := &LogInfo{
+		RemoteAddr:           m[1],
+		Time:                 t,
+		Status:               status,
+		BodyBytesSent:        bytesRead,
+		RequestTime:          ta,
+		UpstreamResponseTime: tr,
+		UpstreamAddr:         m[5] + "/" + m[6],
+		Fields: map[string]string{
+			"frontend_name":     strings.TrimSuffix(m[4], "~"),
+			"backend_name":      m[5],
+			"server_name":       m[6],
+			"termination_state": m[16],
+		},
+	}
+	if strings.HasSuffix(m[4], "~") {
+		// the frontend is an SSL listener
+		logInfo.Fields["ssl"] = "on"
+	}
+	if m[24] != "" {
+		logInfo.Fields["captured_request_headers"] = m[24]
+	}
+	if m[25] != "" {
+		logInfo.Fields["captured_response_headers"] = m[25]
+	}
+	logInfo.setRequest(m[26])
+	return logInfo, nil
+}
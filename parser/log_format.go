@@ -0,0 +1,386 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// LogFormatParser parses lines written by an arbitrary nginx log_format template, e.g.
+	// '$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent'.
+	LogFormatParser struct {
+		prefix   []byte
+		fields   []formatField
+		unescape func(string) string // decodes the escaped values, nil if values are not escaped
+	}
+	formatField struct {
+		name   string
+		set    variableSetter
+		suffix []byte // literal text between this variable and the next one
+		list   bool   // the value is a list of upstream servers, see listVariables
+		// samples of the value which may contain the suffix, e.g. "2021-11-01 00:00:00" of
+		// "%{%Y-%m-%d %H:%M:%S}t", and the number of the suffixes in the value
+		samples    []string
+		separators int
+	}
+	variableSetter func(info *LogInfo, value string) error
+)
+
+var variableSetters = map[string]variableSetter{
+	"remote_addr": func(info *LogInfo, value string) error { info.RemoteAddr = value; return nil },
+	"remote_user": func(info *LogInfo, value string) error { info.RemoteUser = value; return nil },
+	"time_local": func(info *LogInfo, value string) (err error) {
+		info.TimeLocal = value
+		info.Time, err = parseTime(value, timeLocalCache.parse)
+		return
+	},
+	"time_iso8601": func(info *LogInfo, value string) (err error) {
+		info.Time, err = parseTime(value, timeIso8601Cache.parse)
+		return
+	},
+	"msec":            func(info *LogInfo, value string) (err error) { info.Time, err = parseTime(value, ParseMsec); return },
+	"request":         func(info *LogInfo, value string) error { info.setRequest(value); return nil },
+	"request_method":  func(info *LogInfo, value string) error { info.Method = value; return nil },
+	"server_protocol": func(info *LogInfo, value string) error { info.Protocol = value; return nil },
+	"request_uri": func(info *LogInfo, value string) error {
+		info.Path, info.Query, _ = strings.Cut(value, "?")
+		return nil
+	},
+	"uri":             func(info *LogInfo, value string) error { info.Path = value; return nil },
+	"args":            func(info *LogInfo, value string) error { info.Query = value; return nil },
+	"query_string":    func(info *LogInfo, value string) error { info.Query = value; return nil },
+	"status":          func(info *LogInfo, value string) (err error) { info.Status, err = atoi(value); return },
+	"body_bytes_sent": func(info *LogInfo, value string) (err error) { info.BodyBytesSent, err = atoi(value); return },
+	"http_referer":    func(info *LogInfo, value string) error { info.HttpReferer = value; return nil },
+	"http_user_agent": func(info *LogInfo, value string) error { info.HttpUserAgent = value; return nil },
+	"request_time":    func(info *LogInfo, value string) (err error) { info.RequestTime, err = atof(value); return },
+
+	"upstream_response_time": func(info *LogInfo, value string) (err error) {
+		info.UpstreamResponseTime, err = sumTimes(value)
+		return
+	},
+	"upstream_addr":         func(info *LogInfo, value string) error { info.UpstreamAddr = value; return nil },
+	"upstream_status":       func(info *LogInfo, value string) error { info.UpstreamStatus = value; return nil },
+	"upstream_cache_status": func(info *LogInfo, value string) error { info.UpstreamCacheStatus = value; return nil },
+	"host":                  func(info *LogInfo, value string) error { info.Host = value; return nil },
+	"server_name":           func(info *LogInfo, value string) error { info.ServerName = value; return nil },
+	"request_length":        func(info *LogInfo, value string) (err error) { info.RequestLength, err = atoi(value); return },
+	"ssl_protocol":          func(info *LogInfo, value string) error { info.SslProtocol = value; return nil },
+	"ssl_cipher":            func(info *LogInfo, value string) error { info.SslCipher = value; return nil },
+	"http_x_forwarded_for":  func(info *LogInfo, value string) error { info.HttpXForwardedFor = value; return nil },
+}
+
+// listVariables are the variables of upstream servers, whose values are lists separated by
+// ", " and " : " when several servers were contacted, e.g. "0.004, 0.005 : 0.001".
+var listVariables = map[string]bool{
+	"upstream_addr":            true,
+	"upstream_status":          true,
+	"upstream_response_time":   true,
+	"upstream_connect_time":    true,
+	"upstream_header_time":     true,
+	"upstream_response_length": true,
+	"upstream_bytes_received":  true,
+	"upstream_bytes_sent":      true,
+	"upstream_queue_time":      true,
+	"upstream_trailer_time":    true,
+}
+
+// listSeparators separate the values of listVariables.
+var listSeparators = [][]byte{[]byte(", "), []byte(" : ")}
+
+func NewLogFormatParser(format string) (*LogFormatParser, error) {
+	return NewLogFormatParserOf(format, EscapeDefault)
+}
+
+// NewLogFormatParserOf compiles the format whose values are escaped by the escape mode of
+// log_format, which is default, json or none.
+func NewLogFormatParserOf(format, escape string) (*LogFormatParser, error) {
+	unescape, err := unescaperOf(escape)
+	if err != nil {
+		return nil, err
+	}
+	parser, err := newLogFormatParser(format, variableSetters)
+	if err != nil {
+		return nil, err
+	}
+	parser.unescape = unescape
+	return parser, nil
+}
+
+// newLogFormatParser compiles the format with the setters of variables, the variables which
+// have no setter are captured in LogInfo.Fields.
+func newLogFormatParser(format string, setters map[string]variableSetter) (*LogFormatParser, error) {
+	builder := &logFormatBuilder{parser: &LogFormatParser{}}
+	for i := 0; i < len(format); {
+		name, n := scanVariable(format[i:])
+		if n == 0 {
+			builder.literal = append(builder.literal, format[i])
+			i++
+			continue
+		}
+		set, ok := setters[name]
+		if !ok {
+			set = fieldSetter(name)
+		}
+		if err := builder.variable(name, set); err != nil {
+			return nil, err
+		}
+		i += n
+	}
+	return builder.build(format)
+}
+
+// logFormatBuilder builds a LogFormatParser from the literals and variables of a format.
+type logFormatBuilder struct {
+	parser  *LogFormatParser
+	literal []byte // literal text since the last variable
+}
+
+func (builder *logFormatBuilder) variable(name string, set variableSetter) error {
+	fields := builder.parser.fields
+	if len(fields) == 0 {
+		builder.parser.prefix = builder.literal
+	} else if len(builder.literal) == 0 {
+		return fmt.Errorf("variables %v and %v are not separated", fields[len(fields)-1].name, name)
+	} else if err := fields[len(fields)-1].setSuffix(builder.literal); err != nil {
+		return err
+	}
+	builder.parser.fields = append(fields, formatField{name: name, set: set, list: listVariables[name]})
+	builder.literal = nil
+	return nil
+}
+
+// setSuffix sets the suffix of the field, and counts the suffixes in the samples of its value.
+func (field *formatField) setSuffix(suffix []byte) error {
+	field.suffix = suffix
+	if len(field.samples) == 0 {
+		return nil
+	}
+	n := strings.Count(field.samples[0], string(suffix))
+	for _, sample := range field.samples[1:] {
+		if strings.Count(sample, string(suffix)) != n {
+			return fmt.Errorf("variable %v is not separated, the number of %q in its value varies", field.name, suffix)
+		}
+	}
+	field.separators = n
+	return nil
+}
+
+func (builder *logFormatBuilder) build(format string) (*LogFormatParser, error) {
+	fields := builder.parser.fields
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no variables in log format: %v", format)
+	}
+	fields[len(fields)-1].suffix = builder.literal
+	return builder.parser, nil
+}
+
+// scanVariable returns the name and the length of the $variable or ${variable} at the
+// beginning of s, the length is 0 if s does not start with a variable.
+func scanVariable(s string) (string, int) {
+	if len(s) < 2 || s[0] != '$' {
+		return "", 0
+	}
+	if s[1] == '{' {
+		end := 2
+		for end < len(s) && isVariableChar(s[end]) {
+			end++
+		}
+		if end == 2 || end == len(s) || s[end] != '}' {
+			return "", 0
+		}
+		return s[2:end], end + 1
+	}
+	end := 1
+	for end < len(s) && isVariableChar(s[end]) {
+		end++
+	}
+	if end == 1 {
+		return "", 0
+	}
+	return s[1:end], end
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (parser *LogFormatParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	if !bytes.HasPrefix(line, parser.prefix) {
+		return nil, fmt.Errorf("parse log format error: %v", string(line))
+	}
+	var (
+		logInfo = &LogInfo{}
+		i       = len(parser.prefix)
+		last    = len(parser.fields) - 1
+	)
+	for k, field := range parser.fields {
+		var j int
+		if k == last {
+			// the last variable is anchored at the end of line
+			if !bytes.HasSuffix(line[i:], field.suffix) {
+				return nil, fmt.Errorf("parse log format error: %v", string(line))
+			}
+			j = len(line) - len(field.suffix)
+		} else {
+			index := parser.indexSuffix(line[i:], field)
+			if index < 0 {
+				return nil, fmt.Errorf("parse log format error: %v", string(line))
+			}
+			j = i + index
+		}
+		value := string(line[i:j])
+		if parser.unescape != nil {
+			value = parser.unescape(value)
+		}
+		if err := field.set(logInfo, value); err != nil {
+			return nil, fmt.Errorf("convert %v error: %v", field.name, err.Error())
+		}
+		i = j + len(field.suffix)
+	}
+	return logInfo, nil
+}
+
+// indexSuffix returns the index of the suffix of the field in s, which is the end of the value.
+func (parser *LogFormatParser) indexSuffix(s []byte, field formatField) int {
+	for off, separators := 0, field.separators; ; {
+		var index int
+		if parser.unescape != nil {
+			// an escaped quote is not the end of a quoted value
+			index = indexUnescaped(s[off:], field.suffix)
+		} else {
+			index = bytes.Index(s[off:], field.suffix)
+		}
+		if index >= 0 && separators > 0 {
+			// the suffix in the value is not the end of the value
+			off, separators = off+index+len(field.suffix), separators-1
+			continue
+		}
+		if index < 0 {
+			return -1
+		}
+		if !field.list {
+			return off + index
+		}
+		// the suffix in a separator of the list is not the end of the value
+		next := listSeparatorEnd(s, off+index, field.suffix)
+		if next < 0 {
+			return off + index
+		}
+		off = next
+	}
+}
+
+// listSeparatorEnd returns the end of the list separator which covers s[p], or -1 if s[p] is
+// not in a separator followed by another value. The separators which the suffix starts with
+// are the suffix rather than separators, e.g. the ", " of "$upstream_addr, $host".
+func listSeparatorEnd(s []byte, p int, suffix []byte) int {
+	for _, sep := range listSeparators {
+		if bytes.HasPrefix(suffix, sep) {
+			continue
+		}
+		for k := 0; k < len(sep) && k <= p; k++ {
+			if end := p - k + len(sep); bytes.HasPrefix(s[p-k:], sep) && end < len(s) {
+				return end
+			}
+		}
+	}
+	return -1
+}
+
+func (info *LogInfo) setField(name, value string) {
+	if info.Fields == nil {
+		info.Fields = make(map[string]string)
+	}
+	info.Fields[name] = value
+}
+
+// fieldSetter returns the setter which captures the variable in LogInfo.Fields.
+func fieldSetter(name string) variableSetter {
+	return func(info *LogInfo, value string) error {
+		info.setField(name, value)
+		return nil
+	}
+}
+
+// setterOf returns the setter of a nginx variable, or the setter which captures the variable
+// in LogInfo.Fields.
+func setterOf(name string) variableSetter {
+	if set, ok := variableSetters[name]; ok {
+		return set
+	}
+	return fieldSetter(name)
+}
+
+// atoi converts the value of a numeric variable, nginx logs "-" for missing values.
+func atoi(value string) (int, error) {
+	if value == "-" || value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// parseTime converts the value of a time variable by parse, the time is unset for missing
+// values.
+func parseTime(value string, parse func(string) (time.Time, error)) (time.Time, error) {
+	if value == "-" || value == "" {
+		return time.Time{}, nil
+	}
+	return parse(value)
+}
+
+// atof converts the value of a numeric variable, nginx logs "-" for missing values.
+func atof(value string) (float64, error) {
+	if value == "-" || value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// sumTimes sums the times of a variable like $upstream_response_time, whose value is a list
+// separated by commas and colons when several servers were contacted, e.g. "0.010, 0.020 : 0.030".
+func sumTimes(value string) (float64, error) {
+	sum := 0.0
+	for _, group := range strings.Split(value, ":") {
+		for _, t := range strings.Split(group, ",") {
+			f, err := atof(strings.TrimSpace(t))
+			if err != nil {
+				return 0, err
+			}
+			sum += f
+		}
+	}
+	return sum, nil
+}
+
+// msToSeconds converts a duration in milliseconds, negative values which mean the duration is
+// not available are converted to 0.
+func msToSeconds(value string) (float64, error) {
+	f, err := atof(value)
+	if err != nil || f < 0 {
+		return 0, err
+	}
+	return f / 1e3, nil
+}
+
+// usToSeconds converts a duration in microseconds.
+func usToSeconds(value string) (float64, error) {
+	f, err := atof(value)
+	if err != nil || f < 0 {
+		return 0, err
+	}
+	return f / 1e6, nil
+}
+
+// nsToSeconds converts a duration in nanoseconds.
+func nsToSeconds(value string) (float64, error) {
+	f, err := atof(value)
+	if err != nil || f < 0 {
+		return 0, err
+	}
+	return f / 1e9, nil
+}
@@ -1,15 +1,53 @@
 package parser
 
+import "time"
+
 type LogInfo struct {
-	RemoteAddr    string  `json:"remote_addr"`
-	RemoteUser    string  `json:"remote_user"`
-	TimeLocal     string  `json:"time_local"`
-	Request       string  `json:"request"`
-	Method        string  `json:"method"`
-	Protocol      string  `json:"protocol"`
+	RemoteAddr string `json:"remote_addr"`
+	RemoteUser string `json:"remote_user"`
+	TimeLocal  string `json:"time_local"`
+	// Time is parsed from $time_local, $time_iso8601 or $msec
+	Time time.Time `json:"-"`
+	// Request is the full request line, which is split into Method, Path, Query and Protocol
+	Request  string `json:"request"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Query    string `json:"query"`
+	Protocol string `json:"protocol"`
+	// InvalidRequest is set if Request is not a valid HTTP request line, e.g. "-"
+	InvalidRequest bool `json:"-"`
+
 	Status        int     `json:"status"`
 	BodyBytesSent int     `json:"body_bytes_sent"`
 	HttpReferer   string  `json:"http_referer"`
 	HttpUserAgent string  `json:"http_user_agent"`
 	RequestTime   float64 `json:"request_time"`
+
+	// UpstreamResponseTime is the sum of the response times of all contacted upstream servers
+	UpstreamResponseTime float64 `json:"upstream_response_time"`
+	UpstreamAddr         string  `json:"upstream_addr"`
+	UpstreamStatus       string  `json:"upstream_status"`
+	UpstreamCacheStatus  string  `json:"upstream_cache_status"`
+	Host                 string  `json:"host"`
+	ServerName           string  `json:"server_name"`
+	RequestLength        int     `json:"request_length"`
+	SslProtocol          string  `json:"ssl_protocol"`
+	SslCipher            string  `json:"ssl_cipher"`
+	HttpXForwardedFor    string  `json:"http_x_forwarded_for"`
+
+	// Fields holds the variables which have no corresponding field above
+	Fields map[string]string `json:"-"`
+}
+
+// Uri returns the path of the request, or the full request line if it could not be split.
+func (info *LogInfo) Uri() string {
+	if info.Path != "" {
+		return info.Path
+	}
+	return info.Request
+}
+
+// Field returns the value of a variable captured in Fields, e.g. "request_id".
+func (info *LogInfo) Field(name string) string {
+	return info.Fields[name]
 }
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type (
+	// LogfmtParser parses logfmt logs, e.g. `ts=2023-10-31T19:07:45Z status=200 dur=0.12 path="/a b"`,
+	// the keys are mapped by the field mapping.
+	LogfmtParser struct {
+		mapping *FieldMapping
+	}
+)
+
+func NewLogfmtParser(mapping *FieldMapping) *LogfmtParser {
+	return &LogfmtParser{mapping: mapping}
+}
+
+func (parser *LogfmtParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	logInfo, pairs := &LogInfo{}, 0
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := string(line[start:i])
+		if i == len(line) || line[i] != '=' {
+			// a key without value
+			continue
+		}
+		i++
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("parse logfmt log error: unterminated value of %v", key)
+			}
+			s, err := strconv.Unquote(string(line[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("parse logfmt log error: %v", err.Error())
+			}
+			value, i = s, end+1
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			value = string(line[start:i])
+		}
+		if err := parser.mapping.set(logInfo, key, value); err != nil {
+			return nil, err
+		}
+		pairs++
+	}
+	if pairs == 0 {
+		return nil, errors.New("parse logfmt log error: no key=value pairs")
+	}
+	return logInfo, nil
+}
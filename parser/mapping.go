@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unitsPerSecond are the units which numeric fields could be converted from.
+var unitsPerSecond = map[string]float64{
+	"s":  1,
+	"ms": 1e3,
+	"us": 1e6,
+	"ns": 1e9,
+}
+
+type (
+	// FieldMapping maps the fields of structured logs, e.g. the keys of logfmt or the columns of
+	// CSV, to nginx variables. Fields which are not mapped are set as the variables of the same
+	// name, or captured in LogInfo.Fields if there is no such variable.
+	FieldMapping struct {
+		setters map[string]variableSetter
+	}
+)
+
+// ParseFieldMapping parses the mapping like "ts=time_iso8601,client=remote_addr,dur=request_time:ms",
+// the optional unit of durations and $msec timestamps is one of s, ms, us and ns.
+func ParseFieldMapping(mapping string) (*FieldMapping, error) {
+	m := &FieldMapping{setters: make(map[string]variableSetter)}
+	for _, item := range strings.Split(mapping, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field, variable, ok := strings.Cut(item, "=")
+		if !ok || field == "" || variable == "" {
+			return nil, fmt.Errorf("invalid field mapping: %v", item)
+		}
+		variable, unit, hasUnit := strings.Cut(strings.TrimPrefix(variable, "$"), ":")
+		set := setterOf(variable)
+		if hasUnit {
+			perSecond, ok := unitsPerSecond[unit]
+			if !ok {
+				return nil, fmt.Errorf("unsupported unit of field mapping: %v", item)
+			}
+			set = scaledSetter(set, perSecond)
+		}
+		m.setters[field] = set
+	}
+	return m, nil
+}
+
+// setterOf returns the setter of the field.
+func (m *FieldMapping) setterOf(field string) variableSetter {
+	if m != nil {
+		if set, ok := m.setters[field]; ok {
+			return set
+		}
+	}
+	return setterOf(field)
+}
+
+// set sets the value of the field.
+func (m *FieldMapping) set(info *LogInfo, field, value string) error {
+	if err := m.setterOf(field)(info, value); err != nil {
+		return fmt.Errorf("convert %v error: %v", field, err.Error())
+	}
+	return nil
+}
+
+// scaledSetter converts the numeric value to seconds before setting it.
+func scaledSetter(set variableSetter, perSecond float64) variableSetter {
+	return func(info *LogInfo, value string) error {
+		if value == "-" || value == "" {
+			return set(info, value)
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		return set(info, strconv.FormatFloat(f/perSecond, 'f', -1, 64))
+	}
+}
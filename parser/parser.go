@@ -3,16 +3,31 @@ package parser
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
-	"time"
-
-	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
 )
 
 const (
 	LogFormatTypeCombined = "combined"
 	LogFormatTypeJson     = "json"
+	LogFormatTypeApache   = "apache"
+	LogFormatTypeIIS      = "iis"
+	LogFormatTypeNCSA     = "ncsa"
+	LogFormatTypeCaddy    = "caddy"
+	LogFormatTypeTraefik  = "traefik"
+	LogFormatTypeHAProxy  = "haproxy"
+	LogFormatTypeEnvoy    = "envoy"
+	LogFormatTypeALB      = "alb"
+	LogFormatTypeELB      = "elb"
+	LogFormatTypeCF       = "cloudfront"
+	LogFormatTypeW3C      = "w3c"
+	LogFormatTypeError    = "error"
+	LogFormatTypeLogfmt   = "logfmt"
+	LogFormatTypeCSV      = "csv"
+	LogFormatTypeTSV      = "tsv"
+	LogFormatTypeAuto     = "auto"
 	ApacheFormat          = `^([^ ]+) [^ ]+ ([^\/\[]+) \[([^ ]+ [^ ]+)\] \"([A-Z]+) (\S+) (HTTP\/[0-9.]+)" ([\d|-]+) ([\d|-]+) \"(.*?)\" \"([^\"]*)\"`
 	IISFormat             = `^(\S+) \[([^ ]+ [^ ]+)\] "([A-Z]+) (\S+) (HTTP\/[0-9.]+)" ([\d|-]+) ([\d|-]+) \S+ (\S+) (\S+)`
 	NCSAFormat            = `^([^ ]+) [^ ]+ (.+) \[([^ ]+ [^ ]+)\] \"([^ ]+) (.+) (HTTP\/[0-9.]+)\" ([\d|-]+) ([\d|-]+)`
@@ -23,9 +38,17 @@ const (
 
 type (
 	Parser interface {
-		ParseLog(line []byte) *LogInfo
+		// ParseLog parses a line of log, the line may or may not end with a newline.
+		ParseLog(line []byte) (*LogInfo, error)
+	}
+	// StatefulParser is a parser which keeps state between lines, e.g. the columns declared by
+	// a "#Fields" directive, lines must be parsed in order and the state is reset for each file.
+	StatefulParser interface {
+		Parser
+		Reset()
 	}
 	JsonParser struct {
+		mapping *FieldMapping
 	}
 	CombinedParser struct {
 		delimiters [][]byte
@@ -34,29 +57,85 @@ type (
 		delimiters [][]byte
 	}
 	CustomParser struct {
+		format string // the locked format name, all formats are tried if it is empty
 	}
 )
 
-func ParseTime(timeLocal string) time.Time {
-	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", timeLocal)
-	if err != nil {
-		ioutil.Fatal("parse log time error: %v\n", err.Error())
-	}
-	return t
-}
+// ErrSkipLine is returned for lines which are not log entries, e.g. directives and headers,
+// they should be skipped silently.
+var ErrSkipLine = errors.New("skip line")
+
+var (
+	apacheRegex = regexp.MustCompile(ApacheFormat)
+	iisRegex    = regexp.MustCompile(IISFormat)
+	ncsaRegex   = regexp.MustCompile(NCSAFormat)
+)
 
 func NewJsonParser() *JsonParser {
 	return &JsonParser{}
 }
 
-func (parser *JsonParser) ParseLog(line []byte) *LogInfo {
-	logInfo := &LogInfo{}
-	err := json.Unmarshal(line[:len(line)-1], logInfo)
+// NewJsonParserOf returns a parser of JSON logs whose keys are mapped by the field mapping, the
+// keys of nested objects are dotted paths, e.g. "http.status" of {"http": {"status": 200}}.
+func NewJsonParserOf(mapping *FieldMapping) *JsonParser {
+	return &JsonParser{mapping: mapping}
+}
+
+func (parser *JsonParser) ParseLog(line []byte) (*LogInfo, error) {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(bytes.TrimRight(line, "\r\n"), &object)
 	if err != nil {
-		ioutil.Fatal("parse json log error: %v\n", err.Error())
-		return nil
+		return nil, fmt.Errorf("parse json log error: %v", err.Error())
+	}
+
+	logInfo := &LogInfo{}
+	if err = parser.setObject(logInfo, "", object); err != nil {
+		return nil, err
+	}
+	return logInfo, nil
+}
+
+// setObject sets the values of the object, the keys of nested objects are prefixed by the path
+// of their parents.
+func (parser *JsonParser) setObject(info *LogInfo, path string, object map[string]json.RawMessage) error {
+	for key, raw := range object {
+		if len(raw) > 0 && raw[0] == '{' {
+			// nested objects are flattened, the parent key itself is not set
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return fmt.Errorf("parse json log error: %v", err.Error())
+			}
+			if err := parser.setObject(info, path+key+".", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok, err := jsonValue(raw)
+		if err != nil {
+			return fmt.Errorf("parse json log error: %v", err.Error())
+		}
+		if !ok {
+			continue
+		}
+		if err = parser.mapping.set(info, path+key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonValue returns the text of a JSON value, strings are unquoted, and other values, such as
+// numbers and arrays, are kept as is. ok is false for null.
+func jsonValue(raw json.RawMessage) (value string, ok bool, err error) {
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		return "", false, nil
+	case raw[0] == '"':
+		err = json.Unmarshal(raw, &value)
+		return value, err == nil, err
+	default:
+		return string(raw), true, nil
 	}
-	return logInfo
 }
 
 func NewCombinedParser() *CombinedParser {
@@ -69,51 +148,77 @@ func NewCombinedParser() *CombinedParser {
 	}
 }
 
-func (parser *CombinedParser) ParseLog(line []byte) *LogInfo {
-	var (
-		variables = make([]string, 0, 8)
-		i         = 0 // variable start index
-		j         = 0 // variable end index
-		k         = 0 // delimiters and variables index
-	)
-	for k < len(parser.delimiters) && j <= len(line)-len(parser.delimiters[k]) {
-		if bytes.Equal(line[j:j+len(parser.delimiters[k])], parser.delimiters[k]) {
-			variables = append(variables, string(line[i:j]))
-			j = j + len(parser.delimiters[k])
-			i = j
-			k++
-		} else {
-			j++
-		}
-	}
-	if k != len(parser.delimiters) {
-		ioutil.Fatal("parse combined log error: %v\n", string(line))
+func (parser *CombinedParser) ParseLog(line []byte) (*LogInfo, error) {
+	variables, ok := parser.split(line)
+	if !ok {
+		return nil, fmt.Errorf("parse combined log error: %v", string(bytes.TrimRight(line, "\r\n")))
 	}
 	status, err := strconv.Atoi(variables[4])
 	if err != nil {
-		ioutil.Fatal("convert $status to int error: %v\n", variables[4])
+		return nil, fmt.Errorf("convert $status to int error: %v", variables[4])
 	}
 	bodyBytesSent, err := strconv.Atoi(variables[5])
 	if err != nil {
-		ioutil.Fatal("convert $body_bytes_sent to int error: %v\n", variables[5])
+		return nil, fmt.Errorf("convert $body_bytes_sent to int error: %v", variables[5])
 	}
-	return &LogInfo{
+	t, err := ParseTime(variables[2])
+	if err != nil {
+		return nil, fmt.Errorf("convert $time_local to time error: %v", variables[2])
+	}
+	logInfo := &LogInfo{
 		RemoteAddr:    variables[0],
-		RemoteUser:    variables[1],
+		RemoteUser:    unescapeDefault(variables[1]),
 		TimeLocal:     variables[2],
-		Request:       variables[3],
+		Time:          t,
 		Status:        status,
 		BodyBytesSent: bodyBytesSent,
-		HttpReferer:   variables[6],
-		HttpUserAgent: variables[7],
+		HttpReferer:   unescapeDefault(variables[6]),
+		HttpUserAgent: unescapeDefault(variables[7]),
+	}
+	logInfo.setRequest(unescapeDefault(variables[3]))
+	return logInfo, nil
+}
+
+// split splits the line into variables by the delimiters, ok is false if some delimiters
+// are not found.
+func (parser *CombinedParser) split(line []byte) (variables []string, ok bool) {
+	var (
+		i = 0 // variable start index
+		j = 0 // variable end index
+		k = 0 // delimiters and variables index
+	)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		// the last line of file may have no newline
+		line = append(line[:len(line):len(line)], '\n')
+	}
+	variables = make([]string, 0, 8)
+	for k < len(parser.delimiters) && j <= len(line)-len(parser.delimiters[k]) {
+		if line[j] == '\\' {
+			// skip the escaped byte, e.g. \" of Apache
+			j += 2
+		} else if bytes.Equal(line[j:j+len(parser.delimiters[k])], parser.delimiters[k]) {
+			variables = append(variables, string(line[i:j]))
+			j = j + len(parser.delimiters[k])
+			i = j
+			k++
+		} else {
+			j++
+		}
 	}
+	return variables, k == len(parser.delimiters)
 }
 
 func NewCustomParser() *CustomParser {
 	return &CustomParser{}
 }
 
-func (parser *CustomParser) ParseLog(line []byte) *LogInfo {
+// NewCustomParserOf returns a CustomParser which only parses the given format, the format
+// should be one of ApacheFormatName, IISFormatName and NCSAFormatName.
+func NewCustomParserOf(format string) *CustomParser {
+	return &CustomParser{format: format}
+}
+
+func (parser *CustomParser) ParseLog(line []byte) (*LogInfo, error) {
 	// autodetect what type of regex to use
 	// 1. ApacheFormat (?^:^([^ ]+) [^ ]+ ([^\/\[]+) \[([^ ]+) [^ ]+\] \"([^ ]+) ([^ ]+)(?: [^\"]+|)\" ([\d|-]+) ([\d|-]+) \"(.*?)\" \"([^\"]*)\")
 	// 2. IISFormat (?^:^(\S+ \S+) (\S+) (\S+) (\S+) (\S+) ([\d|-]+) ([\d|-]+) \S+ (\S+) (\S+))
@@ -133,16 +238,20 @@ func (parser *CustomParser) ParseLog(line []byte) *LogInfo {
 		if err != nil {
 			bodyBytesSent = 0
 		}
-		return &LogInfo{
+		t, err := ParseTime(matches[3])
+		if err != nil {
+			break
+		}
+		logInfo := &LogInfo{
 			RemoteAddr:    matches[1],
 			TimeLocal:     matches[3],
-			Method:        matches[4],
-			Request:       matches[5],
-			Protocol:      matches[6],
+			Time:          t,
 			Status:        status,
 			BodyBytesSent: bodyBytesSent,
 			HttpUserAgent: matches[10],
 		}
+		logInfo.setRequest(matches[4] + " " + matches[5] + " " + matches[6])
+		return logInfo, nil
 	case IISFormatName:
 		if len(matches) < 10 {
 			break
@@ -159,17 +268,21 @@ func (parser *CustomParser) ParseLog(line []byte) *LogInfo {
 		if err != nil {
 			floatValue = 0
 		}
-		return &LogInfo{
+		t, err := ParseTime(matches[2])
+		if err != nil {
+			break
+		}
+		logInfo := &LogInfo{
 			RemoteAddr:    matches[1],
 			TimeLocal:     matches[2],
-			Method:        matches[3],
-			Request:       matches[4],
-			Protocol:      matches[5],
+			Time:          t,
 			Status:        status,
 			BodyBytesSent: bodyBytesSent,
 			HttpUserAgent: matches[9],
 			RequestTime:   floatValue,
 		}
+		logInfo.setRequest(matches[3] + " " + matches[4] + " " + matches[5])
+		return logInfo, nil
 	case NCSAFormatName:
 		if len(matches) < 9 {
 			break
@@ -182,31 +295,52 @@ func (parser *CustomParser) ParseLog(line []byte) *LogInfo {
 		if err != nil {
 			bodyBytesSent = 0
 		}
-		return &LogInfo{
+		t, err := ParseTime(matches[3])
+		if err != nil {
+			break
+		}
+		logInfo := &LogInfo{
 			RemoteAddr:    matches[1],
 			RemoteUser:    matches[2],
 			TimeLocal:     matches[3],
-			Method:        matches[4],
-			Request:       matches[5],
-			Protocol:      matches[6],
+			Time:          t,
 			Status:        status,
 			BodyBytesSent: bodyBytesSent,
 		}
+		logInfo.setRequest(matches[4] + " " + matches[5] + " " + matches[6])
+		return logInfo, nil
 	}
-	return nil
+	return nil, fmt.Errorf("parse custom log error: %v", string(bytes.TrimRight(line, "\r\n")))
 }
 
 func (parser *CustomParser) MatchRegex(input string) ([]string, string) {
+	if parser.format != "" {
+		if matches := customRegex(parser.format).FindStringSubmatch(input); matches != nil {
+			return matches, parser.format
+		}
+		return nil, ""
+	}
 
-	if match, _ := regexp.MatchString(ApacheFormat, input); match {
-		return regexp.MustCompile(ApacheFormat).FindStringSubmatch(input), ApacheFormatName
+	if matches := apacheRegex.FindStringSubmatch(input); matches != nil {
+		return matches, ApacheFormatName
 	}
-	if match, _ := regexp.MatchString(IISFormat, input); match {
-		return regexp.MustCompile(IISFormat).FindStringSubmatch(input), IISFormatName
+	if matches := iisRegex.FindStringSubmatch(input); matches != nil {
+		return matches, IISFormatName
 	}
-	if match, _ := regexp.MatchString(NCSAFormat, input); match {
-		return regexp.MustCompile(NCSAFormat).FindStringSubmatch(input), NCSAFormatName
+	if matches := ncsaRegex.FindStringSubmatch(input); matches != nil {
+		return matches, NCSAFormatName
 	}
 
 	return nil, ""
 }
+
+func customRegex(format string) *regexp.Regexp {
+	switch format {
+	case ApacheFormatName:
+		return apacheRegex
+	case IISFormatName:
+		return iisRegex
+	default:
+		return ncsaRegex
+	}
+}
@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -10,24 +12,72 @@ var (
 	jsonLog     = []byte("{\"remote_addr\":\"66.102.6.200\",\"time_local\":\"15/Nov/2021:13:44:10 +0800\",\"request\":\"GET / HTTP/1.1\",\"status\":200,\"body_bytes_sent\":1603,\"http_user_agent\":\"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/49.0.2623.75 Safari/537.36 Google Favicon\",\"request_time\":0.20}\n")
 	combinedLog = []byte("103.131.71.189 - - [31/Oct/2023:19:07:45 +0700] \"GET /robots.txt HTTP/1.1\" 200 182 \"-\" \"Mozilla/5.0 (compatible; coccocbot-web/1.0; +http://help.coccoc.com/searchengine)\"\n")
 	// combinedLog = []byte(`253.211.236.165 [10/Sep/2015:17:58:28 +0000] "GET /t/40x40/e3/2a/090e68d68d67eff9cc6de34b5e5b.jpeg HTTP/1.1" 404 785 98 0.021`)
-	apacheLog = []byte(`40.77.167.52 - - [31/Oct/2023:19:07:56 +0700] "GET /checkout/cart/add?product_id=896&redirect=true HTTP/2" 302 0 "-" "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/103.0.5060.134 Safari/537.36"`)
-	iisLog    = []byte(`211.251.138.161 [10/Sep/2015:17:58:28 +0000] "GET /t/40x40/dc/0b/bdbef36aee8a0bef2983c88c49d3.jpeg HTTP/1.1" 200 786 1037 0.798 "40x40" 791 4`)
-	NCSALog   = []byte(`10.100.10.45 - BMAA\will.smith [01/Jul/2013:07:17:28 +0200] "GET /Download/__Omnia__Aus- und Weiterbildung__Konsular- und Verwaltungskonferenz, Programm.doc HTTP/1.1" 200 9076810`)
+	apacheLog     = []byte(`40.77.167.52 - - [31/Oct/2023:19:07:56 +0700] "GET /checkout/cart/add?product_id=896&redirect=true HTTP/2" 302 0 "-" "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/103.0.5060.134 Safari/537.36"`)
+	iisLog        = []byte(`211.251.138.161 [10/Sep/2015:17:58:28 +0000] "GET /t/40x40/dc/0b/bdbef36aee8a0bef2983c88c49d3.jpeg HTTP/1.1" 200 786 1037 0.798 "40x40" 791 4`)
+	customLog     = []byte("example.com 103.131.71.189 - - [31/Oct/2023:19:07:45 +0700] \"GET /robots.txt HTTP/1.1\" 200 182 \"-\" \"curl/8.4.0\" 0.012 0.010 512 7f3a9c\n")
+	caddyLog      = []byte(`{"level":"info","ts":1646861401.5241024,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"127.0.0.1","remote_port":"41342","client_ip":"10.0.0.9","proto":"HTTP/2.0","method":"GET","host":"example.com","uri":"/a?b=1","headers":{"User-Agent":["curl/7.82.0"],"Referer":["https://example.com/"]},"tls":{"resumed":false,"version":772,"cipher_suite":4865,"proto":"h2","server_name":"example.com"}},"bytes_read":12,"user_id":"","duration":0.000929675,"size":10900,"status":200,"resp_headers":{"Server":["Caddy"]}}` + "\n")
+	traefikLog    = []byte(`{"ClientAddr":"10.0.0.1:54321","ClientHost":"10.0.0.1","ClientUsername":"-","DownstreamContentSize":1234,"DownstreamStatus":200,"Duration":12345678,"OriginDuration":11000000,"OriginStatus":200,"RequestContentSize":0,"RequestHost":"example.com","RequestMethod":"GET","RequestPath":"/api?x=1","RequestProtocol":"HTTP/1.1","RouterName":"api@docker","ServiceAddr":"10.0.1.2:8080","StartLocal":"2023-11-01T00:00:00.123456789+08:00","TLSCipher":"TLS_AES_128_GCM_SHA256","TLSVersion":"1.3","level":"info","msg":"","request_User-Agent":"curl/8.4.0","time":"2023-11-01T00:00:00+08:00"}` + "\n")
+	haproxyLog    = []byte(`Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in~ static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"` + "\n")
+	albLog        = []byte(`https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 200 0 57 "GET https://www.example.com:443/index.html?a=1 HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "www.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2018-07-02T22:22:48.364000Z "authenticate,forward" "-" "-" "10.0.0.1:80" "200" "-" "-"` + "\n")
+	elbLog        = []byte(`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 - -1 -1 -1 503 0 0 0 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -` + "\n")
+	cloudFrontLog = []byte("#Version: 1.0\n" +
+		"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status cs(Referer) cs(User-Agent) cs-uri-query time-taken\n" +
+		"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\t-\tMozilla/5.0%20(Windows%20NT%2010.0)\ta=1\t0.001\n")
+	w3cLog = []byte("#Software: Microsoft Internet Information Services 10.0\n" +
+		"#Version: 1.0\n" +
+		"#Date: 2021-11-15 05:44:10\n" +
+		"#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken\n" +
+		"2021-11-15 05:44:10 10.0.0.4 GET /index.html a=1 443 - 66.102.6.200 Mozilla/5.0+(X11;+Linux+x86_64) - 200 0 0 203\n" +
+		"#Fields: time c-ip cs-method cs-uri-stem sc-status\n" +
+		"05:44:11 66.102.6.201 POST /login 302\n")
+	errorLog = []byte(`2023/10/31 19:07:45 [error] 1234#5678: *90 upstream timed out (110: Connection timed out) while reading response header from upstream, client: 1.2.3.4, server: example.com, request: "GET /api?a=1 HTTP/1.1", upstream: "http://10.0.0.1:8080/api?a=1", host: "example.com"` + "\n")
+	envoyLog = []byte(`[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28, 10.0.0.1" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"` + "\n")
+	NCSALog  = []byte(`10.100.10.45 - BMAA\will.smith [01/Jul/2013:07:17:28 +0200] "GET /Download/__Omnia__Aus- und Weiterbildung__Konsular- und Verwaltungskonferenz, Programm.doc HTTP/1.1" 200 9076810`)
 )
 
 func TestParseTime(t *testing.T) {
-	datetime := ParseTime("01/Nov/2021:00:00:00 +0800")
-	assert.NotNil(t, datetime)
+	datetime, err := ParseTime("01/Nov/2021:00:00:00 +0800")
+	assert.Nil(t, err)
 	assert.Equal(t, int64(1635696000000), datetime.UnixMilli())
+
+	// cached
+	datetime, err = ParseTime("01/Nov/2021:00:00:00 +0800")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1635696000000), datetime.UnixMilli())
+
+	datetime, err = ParseTime("2021-11-01T00:00:00+08:00")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1635696000000), datetime.UnixMilli())
+
+	datetime, err = ParseTime("1635696000.123")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1635696000123), datetime.UnixMilli())
+
+	_, err = ParseTime("01/Nov/2021 00:00:00")
+	assert.NotNil(t, err)
+	_, err = ParseTime("-")
+	assert.NotNil(t, err)
+}
+
+func TestParseLogFormatTime(t *testing.T) {
+	p, err := NewLogFormatParser(`$remote_addr $time_iso8601 $msec "$request"`)
+	assert.Nil(t, err)
+	logInfo, err := p.ParseLog([]byte("1.2.3.4 2021-11-01T00:00:00+08:00 1635696000.500 \"GET / HTTP/1.1\"\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1635696000500), logInfo.Time.UnixMilli())
 }
 
 func TestParseLogJson(t *testing.T) {
-	logInfo := NewJsonParser().ParseLog(jsonLog)
+	logInfo, err := NewJsonParser().ParseLog(jsonLog)
+	assert.Nil(t, err)
 	assert.NotNil(t, logInfo)
 	assert.Equal(t, "66.102.6.200", logInfo.RemoteAddr)
 	assert.Equal(t, "", logInfo.RemoteUser)
 	assert.Equal(t, "15/Nov/2021:13:44:10 +0800", logInfo.TimeLocal)
 	assert.Equal(t, "GET / HTTP/1.1", logInfo.Request)
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/", logInfo.Path)
+	assert.Equal(t, "HTTP/1.1", logInfo.Protocol)
 	assert.Equal(t, 200, logInfo.Status)
 	assert.Equal(t, 1603, logInfo.BodyBytesSent)
 	assert.Equal(t, "", logInfo.HttpReferer)
@@ -36,12 +86,17 @@ func TestParseLogJson(t *testing.T) {
 }
 
 func TestParseLogCombined(t *testing.T) {
-	logInfo := NewCombinedParser().ParseLog(combinedLog)
+	logInfo, err := NewCombinedParser().ParseLog(combinedLog)
+	assert.Nil(t, err)
 	assert.NotNil(t, logInfo)
 	assert.Equal(t, "103.131.71.189", logInfo.RemoteAddr)
 	assert.Equal(t, "-", logInfo.RemoteUser)
 	assert.Equal(t, "31/Oct/2023:19:07:45 +0700", logInfo.TimeLocal)
+	assert.Equal(t, int64(1698754065), logInfo.Time.Unix())
 	assert.Equal(t, "GET /robots.txt HTTP/1.1", logInfo.Request)
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/robots.txt", logInfo.Path)
+	assert.Equal(t, "HTTP/1.1", logInfo.Protocol)
 	assert.Equal(t, 200, logInfo.Status)
 	assert.Equal(t, 182, logInfo.BodyBytesSent)
 	assert.Equal(t, "-", logInfo.HttpReferer)
@@ -49,17 +104,22 @@ func TestParseLogCombined(t *testing.T) {
 }
 
 func TestCustomLog(t *testing.T) {
-	aLog := NewCustomParser().ParseLog(apacheLog)
-	iLog := NewCustomParser().ParseLog(iisLog)
-	nLog := NewCustomParser().ParseLog(NCSALog)
+	aLog, err := NewCustomParser().ParseLog(apacheLog)
+	assert.Nil(t, err)
+	iLog, err := NewCustomParser().ParseLog(iisLog)
+	assert.Nil(t, err)
+	nLog, err := NewCustomParser().ParseLog(NCSALog)
+	assert.Nil(t, err)
 
 	// apache log
 	assert.NotNil(t, aLog)
 	assert.Equal(t, "40.77.167.52", aLog.RemoteAddr)
 	assert.Equal(t, "", aLog.RemoteUser)
 	assert.Equal(t, "31/Oct/2023:19:07:56 +0700", aLog.TimeLocal)
+	assert.Equal(t, "GET /checkout/cart/add?product_id=896&redirect=true HTTP/2", aLog.Request)
 	assert.Equal(t, "GET", aLog.Method)
-	assert.Equal(t, "/checkout/cart/add?product_id=896&redirect=true", aLog.Request)
+	assert.Equal(t, "/checkout/cart/add", aLog.Path)
+	assert.Equal(t, "product_id=896&redirect=true", aLog.Query)
 	assert.Equal(t, "HTTP/2", aLog.Protocol)
 	assert.Equal(t, 302, aLog.Status)
 	assert.Equal(t, 0, aLog.BodyBytesSent)
@@ -71,7 +131,7 @@ func TestCustomLog(t *testing.T) {
 	assert.Equal(t, "", iLog.RemoteUser)
 	assert.Equal(t, "10/Sep/2015:17:58:28 +0000", iLog.TimeLocal)
 	assert.Equal(t, "GET", iLog.Method)
-	assert.Equal(t, "/t/40x40/dc/0b/bdbef36aee8a0bef2983c88c49d3.jpeg", iLog.Request)
+	assert.Equal(t, "/t/40x40/dc/0b/bdbef36aee8a0bef2983c88c49d3.jpeg", iLog.Path)
 	assert.Equal(t, "HTTP/1.1", iLog.Protocol)
 	assert.Equal(t, 200, iLog.Status)
 	assert.Equal(t, 786, iLog.BodyBytesSent)
@@ -82,8 +142,671 @@ func TestCustomLog(t *testing.T) {
 	assert.Equal(t, `BMAA\will.smith`, nLog.RemoteUser)
 	assert.Equal(t, "01/Jul/2013:07:17:28 +0200", nLog.TimeLocal)
 	assert.Equal(t, "GET", nLog.Method)
-	assert.Equal(t, "/Download/__Omnia__Aus- und Weiterbildung__Konsular- und Verwaltungskonferenz, Programm.doc", nLog.Request)
+	assert.Equal(t, "/Download/__Omnia__Aus- und Weiterbildung__Konsular- und Verwaltungskonferenz, Programm.doc", nLog.Path)
 	assert.Equal(t, "HTTP/1.1", nLog.Protocol)
 	assert.Equal(t, 200, nLog.Status)
 	assert.Equal(t, 9076810, nLog.BodyBytesSent)
 }
+
+func TestParseLogFormat(t *testing.T) {
+	p, err := NewLogFormatParser(`$host $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time ${upstream_response_time} $request_length $request_id`)
+	assert.Nil(t, err)
+
+	logInfo, err := p.ParseLog(customLog)
+	assert.Nil(t, err)
+	assert.NotNil(t, logInfo)
+	assert.Equal(t, "103.131.71.189", logInfo.RemoteAddr)
+	assert.Equal(t, "-", logInfo.RemoteUser)
+	assert.Equal(t, "31/Oct/2023:19:07:45 +0700", logInfo.TimeLocal)
+	assert.Equal(t, "GET /robots.txt HTTP/1.1", logInfo.Request)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 182, logInfo.BodyBytesSent)
+	assert.Equal(t, "-", logInfo.HttpReferer)
+	assert.Equal(t, "curl/8.4.0", logInfo.HttpUserAgent)
+	assert.Equal(t, 0.012, logInfo.RequestTime)
+	assert.Equal(t, "example.com", logInfo.Host)
+	assert.Equal(t, 0.010, logInfo.UpstreamResponseTime)
+	assert.Equal(t, 512, logInfo.RequestLength)
+	assert.Equal(t, "7f3a9c", logInfo.Field("request_id"))
+}
+
+func TestParseLogFormatUpstreamList(t *testing.T) {
+	p, err := NewLogFormatParser(`$remote_addr [$time_local] "$request" $status $upstream_addr $upstream_status $upstream_response_time $host $request_id`)
+	assert.Nil(t, err)
+
+	// several upstream servers were contacted, and an internal redirect happened
+	logInfo, err := p.ParseLog([]byte(`10.0.0.1 [31/Oct/2023:19:07:45 +0700] "GET / HTTP/1.1" 200 10.0.0.2:80, 10.0.0.3:80 : unix:/tmp/app.sock 502, 200 : 200 0.004, 0.005 : 0.001 ex.com abc`))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:80, 10.0.0.3:80 : unix:/tmp/app.sock", logInfo.UpstreamAddr)
+	assert.Equal(t, "502, 200 : 200", logInfo.UpstreamStatus)
+	assert.InDelta(t, 0.010, logInfo.UpstreamResponseTime, 1e-9)
+	assert.Equal(t, "ex.com", logInfo.Host)
+	assert.Equal(t, "abc", logInfo.Field("request_id"))
+
+	// a suffix which starts with a separator ends the list
+	p, err = NewLogFormatParser(`$upstream_addr, $host`)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`10.0.0.2:80, ex.com`))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:80", logInfo.UpstreamAddr)
+	assert.Equal(t, "ex.com", logInfo.Host)
+}
+
+func TestParseLogFormatCombined(t *testing.T) {
+	p, err := NewLogFormatParser(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`)
+	assert.Nil(t, err)
+	expected, _ := NewCombinedParser().ParseLog(combinedLog)
+	actual, err := p.ParseLog(combinedLog)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestNewLogFormatParserError(t *testing.T) {
+	_, err := NewLogFormatParser("$remote_addr$remote_user")
+	assert.NotNil(t, err)
+
+	_, err = NewLogFormatParser("no variables")
+	assert.NotNil(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	candidate, matched, ok := Detect([][]byte{jsonLog, jsonLog, combinedLog})
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeJson, candidate.Name)
+	assert.Equal(t, 2, matched)
+
+	// combined logs are also Apache logs, the combined parser has higher priority
+	candidate, matched, ok = Detect([][]byte{combinedLog, combinedLog})
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeCombined, candidate.Name)
+	assert.Equal(t, 2, matched)
+	assert.IsType(t, &CombinedParser{}, candidate.New())
+
+	candidate, _, ok = Detect([][]byte{NCSALog})
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeNCSA, candidate.Name)
+	logInfo, err := candidate.New().ParseLog(NCSALog)
+	assert.Nil(t, err)
+	assert.Equal(t, "BMAA\\will.smith", logInfo.RemoteUser)
+
+	candidate, _, ok = Detect([][]byte{iisLog})
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeIIS, candidate.Name)
+
+	_, _, ok = Detect([][]byte{[]byte("not a log line\n")})
+	assert.False(t, ok)
+}
+
+func TestParseLogError(t *testing.T) {
+	truncated := []byte("103.131.71.189 - - [31/Oct/2023:19:07:45 +0700] \"GET /robots.txt HTTP/1.1\" 200")
+	_, err := NewCombinedParser().ParseLog(truncated)
+	assert.NotNil(t, err)
+
+	_, err = NewJsonParser().ParseLog(truncated)
+	assert.NotNil(t, err)
+
+	_, err = NewCustomParser().ParseLog(truncated)
+	assert.NotNil(t, err)
+
+	p, _ := NewLogFormatParser(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`)
+	_, err = p.ParseLog(truncated)
+	assert.NotNil(t, err)
+
+	// the last line of file may have no newline
+	logInfo, err := NewCombinedParser().ParseLog(combinedLog[:len(combinedLog)-1])
+	assert.Nil(t, err)
+	assert.Equal(t, 182, logInfo.BodyBytesSent)
+}
+
+func TestParseLogJsonUpstream(t *testing.T) {
+	line := []byte(`{"remote_addr":"10.0.0.1","time_local":"15/Nov/2021:13:44:10 +0800","request":"GET /api HTTP/2.0","status":502,` +
+		`"body_bytes_sent":0,"request_time":"1.250","upstream_response_time":"1.000, 0.200 : 0.050","upstream_addr":"10.0.1.1:80, 10.0.1.2:80",` +
+		`"upstream_status":"502, 502","upstream_cache_status":"MISS","host":"api.example.com","server_name":"example.com",` +
+		`"request_length":"412","ssl_protocol":"TLSv1.3","ssl_cipher":"TLS_AES_128_GCM_SHA256","http_x_forwarded_for":"1.2.3.4",` +
+		`"request_id":"7f3a9c","geo":{"country":"VN"},"http_cookie":null}` + "\n")
+	logInfo, err := NewJsonParser().ParseLog(line)
+	assert.Nil(t, err)
+	assert.Equal(t, 502, logInfo.Status)
+	assert.Equal(t, 1.25, logInfo.RequestTime)
+	assert.InDelta(t, 1.25, logInfo.UpstreamResponseTime, 1e-9)
+	assert.Equal(t, "10.0.1.1:80, 10.0.1.2:80", logInfo.UpstreamAddr)
+	assert.Equal(t, "502, 502", logInfo.UpstreamStatus)
+	assert.Equal(t, "MISS", logInfo.UpstreamCacheStatus)
+	assert.Equal(t, "api.example.com", logInfo.Host)
+	assert.Equal(t, "example.com", logInfo.ServerName)
+	assert.Equal(t, 412, logInfo.RequestLength)
+	assert.Equal(t, "TLSv1.3", logInfo.SslProtocol)
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", logInfo.SslCipher)
+	assert.Equal(t, "1.2.3.4", logInfo.HttpXForwardedFor)
+	assert.Equal(t, "7f3a9c", logInfo.Field("request_id"))
+	assert.Equal(t, "VN", logInfo.Field("geo.country"))
+	assert.Len(t, logInfo.Fields, 2)
+}
+
+func TestSplitRequest(t *testing.T) {
+	tests := []struct {
+		request, method, path, query, protocol string
+		ok                                     bool
+	}{
+		{"GET /a?b=1&c=2 HTTP/1.1", "GET", "/a", "b=1&c=2", "HTTP/1.1", true},
+		{"HEAD /a HTTP/2.0", "HEAD", "/a", "", "HTTP/2.0", true},
+		{"GET /", "GET", "/", "", "", true},
+		{"GET http://example.com/a?b=1 HTTP/1.1", "GET", "/a", "b=1", "HTTP/1.1", true},
+		{"GET http://example.com HTTP/1.1", "GET", "/", "", "HTTP/1.1", true},
+		{"CONNECT example.com:443 HTTP/1.1", "CONNECT", "example.com:443", "", "HTTP/1.1", true},
+		{"OPTIONS * HTTP/1.1", "OPTIONS", "*", "", "HTTP/1.1", true},
+		{"-", "", "", "", "", false},
+		{"", "", "", "", "", false},
+		{"\\x16\\x03\\x01\\x00\\xA5\\x01", "", "", "", "", false},
+		{"get /a HTTP/1.1", "", "", "", "", false},
+		{"GET HTTP/1.1", "", "", "", "", false},
+	}
+	for _, test := range tests {
+		method, path, query, protocol, ok := SplitRequest(test.request)
+		assert.Equal(t, test.ok, ok, test.request)
+		assert.Equal(t, test.method, method, test.request)
+		assert.Equal(t, test.path, path, test.request)
+		assert.Equal(t, test.query, query, test.request)
+		assert.Equal(t, test.protocol, protocol, test.request)
+	}
+
+	logInfo, err := NewCombinedParser().ParseLog([]byte("1.2.3.4 - - [31/Oct/2023:19:07:45 +0700] \"-\" 400 0 \"-\" \"-\"\n"))
+	assert.Nil(t, err)
+	assert.True(t, logInfo.InvalidRequest)
+	assert.Equal(t, "-", logInfo.Uri())
+}
+
+func TestParseLogCaddy(t *testing.T) {
+	logInfo, err := NewCaddyParser().ParseLog(caddyLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.9", logInfo.RemoteAddr)
+	assert.Equal(t, int64(1646861401524), logInfo.Time.UnixMilli())
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/a", logInfo.Path)
+	assert.Equal(t, "b=1", logInfo.Query)
+	assert.Equal(t, "HTTP/2.0", logInfo.Protocol)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 10900, logInfo.BodyBytesSent)
+	assert.Equal(t, "https://example.com/", logInfo.HttpReferer)
+	assert.Equal(t, "curl/7.82.0", logInfo.HttpUserAgent)
+	assert.Equal(t, 0.000929675, logInfo.RequestTime)
+	assert.Equal(t, "example.com", logInfo.Host)
+	assert.Equal(t, "TLSv1.3", logInfo.SslProtocol)
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", logInfo.SslCipher)
+
+	_, err = NewCaddyParser().ParseLog(jsonLog)
+	assert.NotNil(t, err)
+}
+
+func TestParseLogTraefik(t *testing.T) {
+	logInfo, err := NewTraefikParser().ParseLog(traefikLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", logInfo.RemoteAddr)
+	assert.Equal(t, int64(1698768000123), logInfo.Time.UnixMilli())
+	assert.Equal(t, "GET /api?x=1 HTTP/1.1", logInfo.Request)
+	assert.Equal(t, "/api", logInfo.Path)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 1234, logInfo.BodyBytesSent)
+	assert.Equal(t, "curl/8.4.0", logInfo.HttpUserAgent)
+	assert.Equal(t, 0.012345678, logInfo.RequestTime)
+	assert.Equal(t, 0.011, logInfo.UpstreamResponseTime)
+	assert.Equal(t, "10.0.1.2:8080", logInfo.UpstreamAddr)
+	assert.Equal(t, "TLSv1.3", logInfo.SslProtocol)
+	assert.Equal(t, "api@docker", logInfo.Field("RouterName"))
+
+	_, err = NewTraefikParser().ParseLog(jsonLog)
+	assert.NotNil(t, err)
+}
+
+func TestParseLogHAProxy(t *testing.T) {
+	logInfo, err := NewHAProxyParser().ParseLog(haproxyLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.1.2", logInfo.RemoteAddr)
+	assert.Equal(t, "2009-02-06 12:14:14.655", logInfo.Time.Format("2006-01-02 15:04:05.000"))
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/index.html", logInfo.Path)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 2750, logInfo.BodyBytesSent)
+	assert.Equal(t, 0.109, logInfo.RequestTime)
+	assert.Equal(t, 0.069, logInfo.UpstreamResponseTime)
+	assert.Equal(t, "static/srv1", logInfo.UpstreamAddr)
+	assert.Equal(t, "http-in", logInfo.Field("frontend_name"))
+	assert.Equal(t, "on", logInfo.Field("ssl"))
+	assert.Equal(t, "1wt.eu", logInfo.Field("captured_request_headers"))
+
+	_, err = NewHAProxyParser().ParseLog(combinedLog)
+	assert.NotNil(t, err)
+}
+
+func TestParseLogEnvoy(t *testing.T) {
+	logInfo, err := NewEnvoyParser().ParseLog(envoyLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.35.28", logInfo.RemoteAddr)
+	assert.Equal(t, int64(1460751420310), logInfo.Time.UnixMilli())
+	assert.Equal(t, "POST", logInfo.Method)
+	assert.Equal(t, "/api/v1/locations", logInfo.Path)
+	assert.Equal(t, 204, logInfo.Status)
+	assert.Equal(t, 154, logInfo.RequestLength)
+	assert.Equal(t, 0, logInfo.BodyBytesSent)
+	assert.Equal(t, 0.226, logInfo.RequestTime)
+	assert.Equal(t, 0.1, logInfo.UpstreamResponseTime)
+	assert.Equal(t, "nsq2http", logInfo.HttpUserAgent)
+	assert.Equal(t, "locations", logInfo.Host)
+	assert.Equal(t, "tcp://10.0.2.1:80", logInfo.UpstreamAddr)
+	assert.Equal(t, "-", logInfo.Field("response_flags"))
+	assert.Equal(t, "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2", logInfo.Field("request_id"))
+}
+
+func TestParseLogALB(t *testing.T) {
+	logInfo, err := NewALBParser().ParseLog(albLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.131.39", logInfo.RemoteAddr)
+	assert.Equal(t, "2018-07-02 22:23:00.186", logInfo.Time.Format("2006-01-02 15:04:05.000"))
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/index.html", logInfo.Path)
+	assert.Equal(t, "a=1", logInfo.Query)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 57, logInfo.BodyBytesSent)
+	assert.Equal(t, "curl/7.46.0", logInfo.HttpUserAgent)
+	assert.InDelta(t, 0.171, logInfo.RequestTime, 1e-9)
+	assert.Equal(t, 0.048, logInfo.UpstreamResponseTime)
+	assert.Equal(t, "10.0.0.1:80", logInfo.UpstreamAddr)
+	assert.Equal(t, "www.example.com", logInfo.ServerName)
+	assert.Equal(t, "TLSv1.2", logInfo.SslProtocol)
+	assert.Equal(t, "Root=1-58337281-1d84f3d73c47ec4e58577259", logInfo.Field("trace_id"))
+
+	_, err = NewALBParser().ParseLog(elbLog)
+	assert.NotNil(t, err)
+}
+
+func TestParseLogELB(t *testing.T) {
+	logInfo, err := NewELBParser().ParseLog(elbLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.131.39", logInfo.RemoteAddr)
+	assert.Equal(t, 503, logInfo.Status)
+	assert.Equal(t, "/", logInfo.Path)
+	assert.Equal(t, 0.0, logInfo.RequestTime)
+	assert.Equal(t, "-", logInfo.UpstreamAddr)
+	assert.Equal(t, "my-loadbalancer", logInfo.Field("elb"))
+
+	_, err = NewELBParser().ParseLog(albLog)
+	assert.NotNil(t, err)
+}
+
+func TestParseLogCloudFront(t *testing.T) {
+	var (
+		p     = NewCloudFrontParser()
+		lines = bytes.SplitAfter(cloudFrontLog, []byte("\n"))
+	)
+	for _, line := range lines[:2] {
+		_, err := p.ParseLog(line)
+		assert.Equal(t, ErrSkipLine, err)
+	}
+	logInfo, err := p.ParseLog(lines[2])
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.100", logInfo.RemoteAddr)
+	assert.Equal(t, "2019-12-04T21:02:31Z", logInfo.Time.Format(time.RFC3339))
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/index.html", logInfo.Path)
+	assert.Equal(t, "a=1", logInfo.Query)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 392, logInfo.BodyBytesSent)
+	assert.Equal(t, "Mozilla/5.0 (Windows NT 10.0)", logInfo.HttpUserAgent)
+	assert.Equal(t, 0.001, logInfo.RequestTime)
+	assert.Equal(t, "LAX1", logInfo.Field("x-edge-location"))
+
+	// the default columns are restored
+	p.Reset()
+	_, err = p.ParseLog(lines[2])
+	assert.NotNil(t, err)
+
+	candidate, matched, ok := Detect(lines)
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeCF, candidate.Name)
+	assert.Equal(t, 1, matched)
+}
+
+func TestParseLogW3C(t *testing.T) {
+	var (
+		p       = NewW3CParser()
+		entries []*LogInfo
+	)
+	for _, line := range bytes.SplitAfter(w3cLog, []byte("\n")) {
+		logInfo, err := p.ParseLog(line)
+		if err == ErrSkipLine {
+			continue
+		}
+		assert.Nil(t, err)
+		entries = append(entries, logInfo)
+	}
+	assert.Equal(t, 2, len(entries))
+
+	assert.Equal(t, "66.102.6.200", entries[0].RemoteAddr)
+	assert.Equal(t, "2021-11-15T05:44:10Z", entries[0].Time.Format(time.RFC3339))
+	assert.Equal(t, "GET", entries[0].Method)
+	assert.Equal(t, "/index.html", entries[0].Path)
+	assert.Equal(t, "a=1", entries[0].Query)
+	assert.Equal(t, 200, entries[0].Status)
+	assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64)", entries[0].HttpUserAgent)
+	assert.Equal(t, 0.203, entries[0].RequestTime)
+	assert.Equal(t, "10.0.0.4", entries[0].Field("s-ip"))
+
+	// the columns are re-mapped, and the date comes from the #Date directive
+	assert.Equal(t, "66.102.6.201", entries[1].RemoteAddr)
+	assert.Equal(t, "2021-11-15T05:44:11Z", entries[1].Time.Format(time.RFC3339))
+	assert.Equal(t, "POST", entries[1].Method)
+	assert.Equal(t, "/login", entries[1].Path)
+	assert.Equal(t, 302, entries[1].Status)
+
+	p.Reset()
+	_, err := p.ParseLog([]byte("05:44:11 66.102.6.201 POST /login 302\n"))
+	assert.NotNil(t, err)
+
+	candidate, _, ok := Detect(bytes.SplitAfter(w3cLog, []byte("\n")))
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeW3C, candidate.Name)
+}
+
+func TestParseApacheLogFormat(t *testing.T) {
+	p, err := NewApacheLogFormatParser(`%v %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i" %D %{X-Request-Id}i`)
+	assert.Nil(t, err)
+	logInfo, err := p.ParseLog([]byte(`example.com 40.77.167.52 - frank [31/Oct/2023:19:07:56 +0700] "GET /cart?id=896 HTTP/2" 302 - "-" "bingbot/2.0" 1503 7f3a9c` + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", logInfo.ServerName)
+	assert.Equal(t, "40.77.167.52", logInfo.RemoteAddr)
+	assert.Equal(t, "frank", logInfo.RemoteUser)
+	assert.Equal(t, "31/Oct/2023:19:07:56 +0700", logInfo.TimeLocal)
+	assert.Equal(t, "2023-10-31T19:07:56+07:00", logInfo.Time.Format(time.RFC3339))
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/cart", logInfo.Path)
+	assert.Equal(t, "id=896", logInfo.Query)
+	assert.Equal(t, 302, logInfo.Status)
+	assert.Equal(t, 0, logInfo.BodyBytesSent)
+	assert.Equal(t, "bingbot/2.0", logInfo.HttpUserAgent)
+	assert.Equal(t, 0.001503, logInfo.RequestTime)
+	assert.Equal(t, "-", logInfo.Field("remote_logname"))
+	assert.Equal(t, "7f3a9c", logInfo.Field("http_x_request_id"))
+
+	p, err = NewApacheLogFormatParser(`[%{%Y-%m-%d %H:%M:%S}t] %a %m %U%q %s %{ms}T`)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`[2023-10-31 19:07:56] ::1 POST /login?next=%2F 200 12`))
+	assert.Nil(t, err)
+	// the time without %z is in the local time zone
+	assert.Equal(t, time.Date(2023, 10, 31, 19, 7, 56, 0, time.Local), logInfo.Time)
+	assert.Equal(t, "::1", logInfo.RemoteAddr)
+	assert.Equal(t, "/login", logInfo.Path)
+	assert.Equal(t, "next=%2F", logInfo.Query)
+	assert.Equal(t, 0.012, logInfo.RequestTime)
+
+	// the spaces in the unbracketed time are not the separators
+	p, err = NewApacheLogFormatParser(`%{%Y-%m-%d %H:%M:%S}t %a %{begin:%d/%b/%Y %T %z}t %s`)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`2023-10-31 19:07:56 ::1 31/Oct/2023 19:07:56 +0700 200`))
+	assert.Nil(t, err)
+	assert.Equal(t, "2023-10-31T19:07:56+07:00", logInfo.Time.Format(time.RFC3339))
+	assert.Equal(t, "::1", logInfo.RemoteAddr)
+	assert.Equal(t, 200, logInfo.Status)
+
+	// the days padded with spaces make the number of spaces vary
+	_, err = NewApacheLogFormatParser(`%{%b %e %H:%M:%S}t %h`)
+	assert.NotNil(t, err)
+	_, err = NewApacheLogFormatParser(`[%{%b %e %H:%M:%S}t] %h`)
+	assert.Nil(t, err)
+
+	p, err = NewApacheLogFormatParser(`%{sec}t %h %T`)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`1698754076 40.77.167.52 2`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1698754076), logInfo.Time.Unix())
+	assert.Equal(t, 2.0, logInfo.RequestTime)
+
+	for _, format := range []string{`%h %Z`, `%h %{Referer`, `%h %`, `%h%u`, `%{%Q}t %h`, `%{Referer}i %{m}T`} {
+		_, err = NewApacheLogFormatParser(format)
+		assert.NotNil(t, err, format)
+	}
+}
+
+func TestParseErrorLog(t *testing.T) {
+	logInfo, err := NewErrorLogParser().ParseLog(errorLog)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2023, 10, 31, 19, 7, 45, 0, time.Local), logInfo.Time)
+	assert.Equal(t, "error", logInfo.Field("level"))
+	assert.Equal(t, "1234", logInfo.Field("pid"))
+	assert.Equal(t, "5678", logInfo.Field("tid"))
+	assert.Equal(t, "90", logInfo.Field("connection"))
+	assert.Equal(t, "upstream timed out (110: Connection timed out) while reading response header from upstream", logInfo.Field("message"))
+	assert.Equal(t, "1.2.3.4", logInfo.RemoteAddr)
+	assert.Equal(t, "example.com", logInfo.ServerName)
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/api", logInfo.Path)
+	assert.Equal(t, "http://10.0.0.1:8080/api?a=1", logInfo.UpstreamAddr)
+	assert.Equal(t, "example.com", logInfo.Host)
+
+	logInfo, err = NewErrorLogParser().ParseLog([]byte("2023/10/31 19:07:45 [alert] 1#1: worker process 1234 exited on signal 11\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "alert", logInfo.Field("level"))
+	assert.Equal(t, "worker process 1234 exited on signal 11", logInfo.Field("message"))
+	assert.Equal(t, "", logInfo.RemoteAddr)
+
+	for _, line := range [][]byte{combinedLog, []byte("2023/10/31 19:07:45 [fatal] 1#1: x"), []byte("2023/10/31 19:07:45 [error] x: y")} {
+		_, err = NewErrorLogParser().ParseLog(line)
+		assert.NotNil(t, err)
+	}
+
+	candidate, _, ok := Detect([][]byte{errorLog})
+	assert.True(t, ok)
+	assert.Equal(t, LogFormatTypeError, candidate.Name)
+}
+
+func TestSplitSyslog(t *testing.T) {
+	for line, expected := range map[string][3]string{
+		"<190>Oct 31 19:07:45 web-1 nginx: GET /":                                  {"web-1", "nginx", "GET /"},
+		"Oct  1 19:07:45 web-1 nginx[1234]: GET /":                                 {"web-1", "nginx", "GET /"},
+		"Oct 31 19:07:45 nginx: GET /":                                             {"", "nginx", "GET /"},
+		"2023-10-31T19:07:45.123456+07:00 web-1 nginx: GET /":                      {"web-1", "nginx", "GET /"},
+		"<190>1 2023-10-31T19:07:45.003Z web-2 nginx 1234 - - GET /":               {"web-2", "nginx", "GET /"},
+		`<190>1 2023-10-31T19:07:45.003Z web-2 nginx - ID47 [a x="]\"]"][b] GET /`: {"web-2", "nginx", "GET /"},
+		"<190>1 2023-10-31T19:07:45.003Z web-2 nginx - - - \xEF\xBB\xBFGET /":      {"web-2", "nginx", "GET /"},
+	} {
+		hostname, tag, message, ok := SplitSyslog([]byte(line))
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, [3]string{string(hostname), string(tag), string(message)}, line)
+	}
+
+	for _, line := range [][]byte{combinedLog, errorLog, haproxyLog[16:], []byte("<abc>Oct 31 19:07:45 web-1 nginx: GET /")} {
+		_, _, _, ok := SplitSyslog(line)
+		assert.False(t, ok, string(line))
+	}
+}
+
+func TestParseLogSyslog(t *testing.T) {
+	p := NewSyslogParser(NewCombinedParser())
+	logInfo, err := p.ParseLog(append([]byte("<190>Oct 31 19:07:45 web-1 nginx: "), combinedLog...))
+	assert.Nil(t, err)
+	assert.Equal(t, "103.131.71.189", logInfo.RemoteAddr)
+	assert.Equal(t, "/robots.txt", logInfo.Path)
+	assert.Equal(t, "web-1", logInfo.Field("syslog_hostname"))
+	assert.Equal(t, "nginx", logInfo.Field("syslog_tag"))
+
+	// lines without syslog header are parsed as is
+	logInfo, err = p.ParseLog(combinedLog)
+	assert.Nil(t, err)
+	assert.Equal(t, "103.131.71.189", logInfo.RemoteAddr)
+	assert.Equal(t, "", logInfo.Field("syslog_hostname"))
+
+	_, ok := NewSyslogParser(NewW3CParser()).(StatefulParser)
+	assert.True(t, ok)
+	_, ok = p.(StatefulParser)
+	assert.False(t, ok)
+}
+
+func TestParseFieldMapping(t *testing.T) {
+	mapping, err := ParseFieldMapping("client=remote_addr, dur=$request_time:ms,ts=msec:ms")
+	assert.Nil(t, err)
+	logInfo := &LogInfo{}
+	assert.Nil(t, mapping.set(logInfo, "client", "1.2.3.4"))
+	assert.Nil(t, mapping.set(logInfo, "dur", "120"))
+	assert.Nil(t, mapping.set(logInfo, "ts", "1698754076123"))
+	assert.Nil(t, mapping.set(logInfo, "status", "200"))
+	assert.Nil(t, mapping.set(logInfo, "trace", "abc"))
+	assert.Equal(t, "1.2.3.4", logInfo.RemoteAddr)
+	assert.Equal(t, 0.12, logInfo.RequestTime)
+	assert.Equal(t, int64(1698754076123), logInfo.Time.UnixMilli())
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, "abc", logInfo.Field("trace"))
+	assert.NotNil(t, mapping.set(logInfo, "dur", "fast"))
+
+	for _, m := range []string{"client", "=remote_addr", "dur=request_time:h"} {
+		_, err = ParseFieldMapping(m)
+		assert.NotNil(t, err, m)
+	}
+}
+
+func TestParseLogJsonMapping(t *testing.T) {
+	mapping, err := ParseFieldMapping("client_ip=remote_addr,ts=msec,duration_ms=request_time:ms,http.status=status,http.request.uri=request_uri")
+	assert.Nil(t, err)
+	p := NewJsonParserOf(mapping)
+	logInfo, err := p.ParseLog([]byte(`{"client_ip":"1.2.3.4","ts":1698754076.123,"duration_ms":"120","http":{"status":"404","request":{"uri":"/a?b=1","headers":["x"]}},"body_bytes_sent":"1603","request_id":null}` + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", logInfo.RemoteAddr)
+	assert.Equal(t, int64(1698754076123), logInfo.Time.UnixMilli())
+	assert.Equal(t, 0.12, logInfo.RequestTime)
+	assert.Equal(t, 404, logInfo.Status)
+	assert.Equal(t, "/a", logInfo.Path)
+	assert.Equal(t, "b=1", logInfo.Query)
+	assert.Equal(t, 1603, logInfo.BodyBytesSent)
+	assert.Equal(t, `["x"]`, logInfo.Field("http.request.headers"))
+	_, ok := logInfo.Fields["request_id"]
+	assert.False(t, ok)
+	// the nested objects are flattened only
+	_, ok = logInfo.Fields["http"]
+	assert.False(t, ok)
+	_, ok = logInfo.Fields["http.request"]
+	assert.False(t, ok)
+
+	// the missing times are unset
+	for _, line := range []string{`{"time_local":"","status":200}`, `{"time_local":"-","status":200}`, `{"ts":"-","status":200}`} {
+		logInfo, err = p.ParseLog([]byte(line))
+		assert.Nil(t, err, line)
+		assert.True(t, logInfo.Time.IsZero(), line)
+		assert.Equal(t, 200, logInfo.Status, line)
+	}
+
+	_, err = p.ParseLog([]byte(`{"duration_ms":"fast"}`))
+	assert.NotNil(t, err)
+}
+
+func TestParseLogLogfmt(t *testing.T) {
+	mapping, err := ParseFieldMapping("ts=time_iso8601,dur=request_time,method=request_method,path=request_uri")
+	assert.Nil(t, err)
+	p := NewLogfmtParser(mapping)
+	logInfo, err := p.ParseLog([]byte(`ts=2023-10-31T19:07:45Z method=GET path="/a b?c=\"d\"" status=200 dur=0.12 debug` + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2023-10-31T19:07:45Z", logInfo.Time.Format(time.RFC3339))
+	assert.Equal(t, "GET", logInfo.Method)
+	assert.Equal(t, "/a b", logInfo.Path)
+	assert.Equal(t, `c="d"`, logInfo.Query)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 0.12, logInfo.RequestTime)
+
+	for _, line := range []string{`path="/a`, "debug", `status=ok`} {
+		_, err = p.ParseLog([]byte(line))
+		assert.NotNil(t, err, line)
+	}
+}
+
+func TestParseLogCSV(t *testing.T) {
+	mapping, err := ParseFieldMapping("client=remote_addr,ts=time_iso8601,ua=http_user_agent,dur_ms=request_time:ms")
+	assert.Nil(t, err)
+	p := NewCSVParser(mapping, nil)
+	_, err = p.ParseLog([]byte("client,ts,ua,status,dur_ms\n"))
+	assert.Equal(t, ErrSkipLine, err)
+	logInfo, err := p.ParseLog([]byte(`1.2.3.4,2023-10-31T19:07:45Z,"Mozilla/5.0 (X11, Linux)",200,120` + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", logInfo.RemoteAddr)
+	assert.Equal(t, "2023-10-31T19:07:45Z", logInfo.Time.Format(time.RFC3339))
+	assert.Equal(t, "Mozilla/5.0 (X11, Linux)", logInfo.HttpUserAgent)
+	assert.Equal(t, 200, logInfo.Status)
+	assert.Equal(t, 0.12, logInfo.RequestTime)
+	_, err = p.ParseLog([]byte("1.2.3.4,200\n"))
+	assert.NotNil(t, err)
+
+	// the header row is read again after reset
+	p.Reset()
+	_, err = p.ParseLog([]byte("remote_addr,status\n"))
+	assert.Equal(t, ErrSkipLine, err)
+	logInfo, err = p.ParseLog([]byte("1.2.3.5,404\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.5", logInfo.RemoteAddr)
+	assert.Equal(t, 404, logInfo.Status)
+
+	// the columns are given
+	p = NewTSVParser(nil, []string{"remote_addr", "request", "status"})
+	logInfo, err = p.ParseLog([]byte("1.2.3.4\tGET /a HTTP/1.1\t200\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4", logInfo.RemoteAddr)
+	assert.Equal(t, "/a", logInfo.Path)
+	assert.Equal(t, 200, logInfo.Status)
+}
+
+func TestUnescape(t *testing.T) {
+	assert.Equal(t, `中 "a\b" \x2`, unescapeDefault(`\xE4\xB8\xAD \x22a\x5Cb\" \x2`))
+	assert.Equal(t, `say "hi"`, unescapeDefault(`say \"hi\"`))
+	assert.Equal(t, "a\"b\\/\n\t中😀 \\u12", unescapeJson(`a\"b\\\/\n\t\u4e2d\ud83d\ude00 \u12`))
+	assert.Equal(t, 7, indexUnescaped([]byte(`a\" b\\" c`), []byte(`" `)))
+	assert.Equal(t, -1, indexUnescaped([]byte(`a\" b`), []byte(`" `)))
+}
+
+func TestParseLogEscape(t *testing.T) {
+	line := []byte(`1.2.3.4 - - [31/Oct/2023:19:07:45 +0700] "GET /\xE4\xB8\xAD HTTP/1.1" 200 182 "-" "Mozilla \x22quoted\x22"` + "\n")
+	logInfo, err := NewCombinedParser().ParseLog(line)
+	assert.Nil(t, err)
+	assert.Equal(t, "/中", logInfo.Path)
+	assert.Equal(t, `Mozilla "quoted"`, logInfo.HttpUserAgent)
+
+	// the escaped quotes of Apache
+	line = []byte(`1.2.3.4 - - [31/Oct/2023:19:07:45 +0700] "GET / HTTP/1.1" 200 182 "-" "Mozilla \" 200 1 \"x"` + "\n")
+	logInfo, err = NewCombinedParser().ParseLog(line)
+	assert.Nil(t, err)
+	assert.Equal(t, `Mozilla " 200 1 "x`, logInfo.HttpUserAgent)
+
+	format := `$remote_addr "$request" "$http_user_agent" $status`
+	p, err := NewLogFormatParser(format)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`1.2.3.4 "GET /\xE4\xB8\xAD HTTP/1.1" "a\x22 b" 200`))
+	assert.Nil(t, err)
+	assert.Equal(t, "/中", logInfo.Path)
+	assert.Equal(t, `a" b`, logInfo.HttpUserAgent)
+	assert.Equal(t, 200, logInfo.Status)
+
+	p, err = NewLogFormatParserOf(format, EscapeJson)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`1.2.3.4 "GET /\u4e2d HTTP/1.1" "a\" b" 200`))
+	assert.Nil(t, err)
+	assert.Equal(t, "/中", logInfo.Path)
+	assert.Equal(t, `a" b`, logInfo.HttpUserAgent)
+
+	p, err = NewLogFormatParserOf(format, EscapeNone)
+	assert.Nil(t, err)
+	logInfo, err = p.ParseLog([]byte(`1.2.3.4 "GET /\x41 HTTP/1.1" "a b" 200`))
+	assert.Nil(t, err)
+	assert.Equal(t, `/\x41`, logInfo.Path)
+
+	_, err = NewLogFormatParserOf(format, "url")
+	assert.NotNil(t, err)
+}
+
+func TestDetectProxies(t *testing.T) {
+	for name, line := range map[string][]byte{
+		LogFormatTypeCaddy:   caddyLog,
+		LogFormatTypeTraefik: traefikLog,
+		LogFormatTypeHAProxy: haproxyLog,
+		LogFormatTypeEnvoy:   envoyLog,
+		LogFormatTypeALB:     albLog,
+		LogFormatTypeELB:     elbLog,
+	} {
+		candidate, _, ok := Detect([][]byte{line})
+		assert.True(t, ok)
+		assert.Equal(t, name, candidate.Name)
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import "strings"
+
+// SplitRequest splits a request line like "GET /index.html?a=1 HTTP/1.1" into the method, path,
+// raw query and protocol. ok is false if the line is not a valid HTTP request, e.g. "-" or
+// the garbage of TLS handshakes sent to a plain HTTP port.
+func SplitRequest(request string) (method, path, query, protocol string, ok bool) {
+	i := strings.IndexByte(request, ' ')
+	if i <= 0 || !isMethod(request[:i]) {
+		return "", "", "", "", false
+	}
+	method, target := request[:i], request[i+1:]
+
+	// the protocol is absent in HTTP/0.9, and the target may contain spaces in some logs
+	if j := strings.LastIndexByte(target, ' '); j >= 0 && strings.HasPrefix(target[j+1:], "HTTP/") {
+		target, protocol = target[:j], target[j+1:]
+	}
+	if target == "" {
+		return "", "", "", "", false
+	}
+
+	switch {
+	case target[0] == '/' || target == "*":
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		// absolute form sent to proxies, e.g. "GET http://example.com/index.html HTTP/1.1"
+		rest := target[strings.Index(target, "//")+2:]
+		if k := strings.IndexAny(rest, "/?"); k >= 0 {
+			target = rest[k:]
+		} else {
+			target = "/"
+		}
+	case method == "CONNECT":
+		// authority form, e.g. "CONNECT example.com:443 HTTP/1.1"
+	default:
+		return "", "", "", "", false
+	}
+
+	path, query, _ = strings.Cut(target, "?")
+	if path == "" {
+		path = "/"
+	}
+	return method, path, query, protocol, true
+}
+
+func isMethod(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; (c < 'A' || c > 'Z') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// setRequest sets the request line and its parts, InvalidRequest is set if the line could
+// not be split.
+func (info *LogInfo) setRequest(request string) {
+	info.Request = request
+	method, path, query, protocol, ok := SplitRequest(request)
+	if !ok {
+		info.InvalidRequest = true
+		return
+	}
+	info.Method, info.Path, info.Query, info.Protocol = method, path, query, protocol
+}
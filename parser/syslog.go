@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"bytes"
+	"time"
+)
+
+const (
+	// rfc3164TimeLayout is the layout of RFC 3164 timestamps, e.g. "Oct 31 19:07:45", the day is padded by a space
+	rfc3164TimeLayout = time.Stamp
+)
+
+type (
+	// SyslogParser strips the RFC 3164 or RFC 5424 header of lines shipped via syslog, then parses
+	// the message by the wrapped parser, the hostname and tag of the header are captured in
+	// LogInfo.Fields as syslog_hostname and syslog_tag. Lines without syslog header are parsed as is.
+	SyslogParser struct {
+		parser Parser
+	}
+	statefulSyslogParser struct {
+		SyslogParser
+	}
+)
+
+// NewSyslogParser wraps the parser, the returned parser is a StatefulParser if the wrapped one is.
+func NewSyslogParser(parser Parser) Parser {
+	if _, ok := parser.(StatefulParser); ok {
+		return &statefulSyslogParser{SyslogParser{parser: parser}}
+	}
+	return &SyslogParser{parser: parser}
+}
+
+func (parser *SyslogParser) ParseLog(line []byte) (*LogInfo, error) {
+	hostname, tag, message, ok := SplitSyslog(line)
+	if !ok {
+		return parser.parser.ParseLog(line)
+	}
+	logInfo, err := parser.parser.ParseLog(message)
+	if err != nil {
+		return nil, err
+	}
+	logInfo.setField("syslog_hostname", string(hostname))
+	logInfo.setField("syslog_tag", string(tag))
+	return logInfo, nil
+}
+
+func (parser *statefulSyslogParser) Reset() {
+	parser.parser.(StatefulParser).Reset()
+}
+
+// SplitSyslog splits the line into the hostname, tag and message of the syslog header, which is
+// either RFC 3164, e.g. "<190>Oct 31 19:07:45 web-1 nginx: message", with an optional priority
+// and an optional RFC 3339 timestamp instead, or RFC 5424, e.g.
+// "<190>1 2023-10-31T19:07:45.003Z web-1 nginx 1234 - - message". ok is false if the line has no
+// syslog header.
+func SplitSyslog(line []byte) (hostname, tag, message []byte, ok bool) {
+	rest := line
+	if len(rest) > 0 && rest[0] == '<' {
+		end := bytes.IndexByte(rest, '>')
+		if end < 2 || end > 4 || !isDigits(string(rest[1:end])) {
+			return nil, nil, nil, false
+		}
+		rest = rest[end+1:]
+		if len(rest) > 2 && rest[0] == '1' && rest[1] == ' ' {
+			return splitRFC5424(rest[2:])
+		}
+	}
+
+	// RFC 3164 timestamp, or RFC 3339 timestamp of high precision templates
+	if len(rest) > len(rfc3164TimeLayout) && rest[len(rfc3164TimeLayout)] == ' ' {
+		if _, err := time.Parse(rfc3164TimeLayout, string(rest[:len(rfc3164TimeLayout)])); err == nil {
+			return splitRFC3164(rest[len(rfc3164TimeLayout)+1:])
+		}
+	}
+	timestamp, after, found := bytes.Cut(rest, []byte(" "))
+	if !found {
+		return nil, nil, nil, false
+	}
+	if _, err := time.Parse(time.RFC3339, string(timestamp)); err != nil {
+		return nil, nil, nil, false
+	}
+	return splitRFC3164(after)
+}
+
+// splitRFC3164 splits "hostname tag[pid]: message", the hostname may be omitted.
+func splitRFC3164(rest []byte) (hostname, tag, message []byte, ok bool) {
+	hostname, after, found := bytes.Cut(rest, []byte(" "))
+	if !found {
+		return nil, nil, nil, false
+	}
+	if bytes.HasSuffix(hostname, []byte(":")) {
+		hostname = nil
+	} else {
+		rest = after
+	}
+	tag, message, found = bytes.Cut(rest, []byte(": "))
+	if !found || len(tag) == 0 || bytes.IndexByte(tag, ' ') >= 0 {
+		return nil, nil, nil, false
+	}
+	if i := bytes.IndexByte(tag, '['); i > 0 {
+		tag = tag[:i]
+	}
+	return hostname, tag, message, true
+}
+
+// splitRFC5424 splits "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG".
+func splitRFC5424(rest []byte) (hostname, tag, message []byte, ok bool) {
+	var fields [5][]byte
+	for i := range fields {
+		var found bool
+		fields[i], rest, found = bytes.Cut(rest, []byte(" "))
+		if !found {
+			return nil, nil, nil, false
+		}
+	}
+	hostname, tag = fields[1], fields[2]
+
+	// STRUCTURED-DATA is "-" or elements like `[id key="value"]`, values may contain escaped "]"
+	if len(rest) > 0 && rest[0] == '-' {
+		rest = rest[1:]
+	} else {
+		for len(rest) > 0 && rest[0] == '[' {
+			i, quoted := 1, false
+			for ; i < len(rest); i++ {
+				if rest[i] == '\\' {
+					i++
+				} else if rest[i] == '"' {
+					quoted = !quoted
+				} else if rest[i] == ']' && !quoted {
+					break
+				}
+			}
+			if i >= len(rest) {
+				return nil, nil, nil, false
+			}
+			rest = rest[i+1:]
+		}
+	}
+	message = bytes.TrimPrefix(bytes.TrimPrefix(rest, []byte(" ")), []byte("\xEF\xBB\xBF"))
+	return hostname, tag, message, true
+}
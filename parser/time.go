@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TimeLocalLayout is the layout of $time_local
+	TimeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+	// TimeIso8601Layout is the layout of $time_iso8601
+	TimeIso8601Layout = time.RFC3339
+	// TimeW3CLayout is the layout of the date and time columns of W3C extended logs, which are in UTC
+	TimeW3CLayout = "2006-01-02 15:04:05"
+	// TimeErrorLogLayout is the layout of nginx error logs, which are in the local time zone
+	TimeErrorLogLayout = "2006/01/02 15:04:05"
+)
+
+type (
+	// timeCache caches the last parsed timestamp of a layout, consecutive lines of logs
+	// almost always share the same second.
+	timeCache struct {
+		layout   string
+		location *time.Location // the time zone of layouts without offset, UTC if it is nil
+		last     atomic.Pointer[cachedTime]
+	}
+	cachedTime struct {
+		value string
+		t     time.Time
+	}
+)
+
+var (
+	timeLocalCache   = &timeCache{layout: TimeLocalLayout}
+	timeIso8601Cache = &timeCache{layout: TimeIso8601Layout}
+	timeW3CCache     = &timeCache{layout: TimeW3CLayout}
+	timeErrorCache   = &timeCache{layout: TimeErrorLogLayout, location: time.Local}
+)
+
+func (c *timeCache) parse(value string) (time.Time, error) {
+	if last := c.last.Load(); last != nil && last.value == value {
+		return last.t, nil
+	}
+	var (
+		t   time.Time
+		err error
+	)
+	if c.location != nil {
+		t, err = time.ParseInLocation(c.layout, value, c.location)
+	} else {
+		t, err = time.Parse(c.layout, value)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.last.Store(&cachedTime{value: value, t: t})
+	return t, nil
+}
+
+// ParseTime parses the value of $time_local, $time_iso8601 or $msec.
+func ParseTime(value string) (time.Time, error) {
+	switch {
+	case value == "" || value == "-":
+		return time.Time{}, errors.New("empty time")
+	case strings.ContainsRune(value, '/'):
+		return timeLocalCache.parse(value)
+	case strings.ContainsRune(value, 'T'):
+		return timeIso8601Cache.parse(value)
+	default:
+		return ParseMsec(value)
+	}
+}
+
+// ParseMsec parses the value of $msec, the seconds since epoch with milliseconds resolution,
+// e.g. "1635696000.123".
+func ParseMsec(value string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(value, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var ns int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		ns, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for i := len(frac); i < 9; i++ {
+			ns *= 10
+		}
+	}
+	return time.Unix(s, ns), nil
+}
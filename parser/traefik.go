@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraefikParser parses the JSON access logs of Traefik, e.g.
+// {"ClientHost":"10.0.0.1","DownstreamStatus":200,"Duration":12345678,"RequestMethod":"GET",...}
+type TraefikParser struct {
+}
+
+// traefikSetters maps the fields of Traefik access logs, durations are in nanoseconds and
+// headers are prefixed by "request_" or "downstream_".
+var traefikSetters = map[string]variableSetter{
+	"ClientHost":            func(info *LogInfo, value string) error { info.RemoteAddr = value; return nil },
+	"ClientUsername":        func(info *LogInfo, value string) error { info.RemoteUser = value; return nil },
+	"StartLocal":            func(info *LogInfo, value string) (err error) { info.Time, err = ParseTime(value); return },
+	"RequestMethod":         func(info *LogInfo, value string) error { info.Method = value; return nil },
+	"RequestPath":           func(info *LogInfo, value string) error { info.Request = value; return nil },
+	"RequestProtocol":       func(info *LogInfo, value string) error { info.Protocol = value; return nil },
+	"RequestHost":           func(info *LogInfo, value string) error { info.Host = value; return nil },
+	"RequestContentSize":    func(info *LogInfo, value string) (err error) { info.RequestLength, err = atoi(value); return },
+	"DownstreamStatus":      func(info *LogInfo, value string) (err error) { info.Status, err = atoi(value); return },
+	"DownstreamContentSize": func(info *LogInfo, value string) (err error) { info.BodyBytesSent, err = atoi(value); return },
+	"Duration":              func(info *LogInfo, value string) (err error) { info.RequestTime, err = nsToSeconds(value); return },
+	"OriginDuration": func(info *LogInfo, value string) (err error) {
+		info.UpstreamResponseTime, err = nsToSeconds(value)
+		return
+	},
+	"OriginStatus":            func(info *LogInfo, value string) error { info.UpstreamStatus = value; return nil },
+	"ServiceAddr":             func(info *LogInfo, value string) error { info.UpstreamAddr = value; return nil },
+	"TLSCipher":               func(info *LogInfo, value string) error { info.SslCipher = value; return nil },
+	"TLSVersion":              func(info *LogInfo, value string) error { info.SslProtocol = "TLSv" + value; return nil },
+	"request_Referer":         func(info *LogInfo, value string) error { info.HttpReferer = value; return nil },
+	"request_User-Agent":      func(info *LogInfo, value string) error { info.HttpUserAgent = value; return nil },
+	"request_X-Forwarded-For": func(info *LogInfo, value string) error { info.HttpXForwardedFor = value; return nil },
+}
+
+func NewTraefikParser() *TraefikParser {
+	return &TraefikParser{}
+}
+
+func (parser *TraefikParser) ParseLog(line []byte) (*LogInfo, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimRight(line, "\r\n"), &object); err != nil {
+		return nil, fmt.Errorf("parse traefik log error: %v", err.Error())
+	}
+	if _, ok := object["DownstreamStatus"]; !ok {
+		return nil, errors.New("parse traefik log error: not an access log")
+	}
+
+	logInfo := &LogInfo{}
+	for key, raw := range object {
+		value, ok, err := jsonValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse traefik log error: %v", err.Error())
+		}
+		if !ok {
+			continue
+		}
+		if setter, ok := traefikSetters[key]; ok {
+			err = setter(logInfo, value)
+		} else {
+			logInfo.setField(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("convert %v error: %v", key, err.Error())
+		}
+	}
+
+	// RequestPath contains the query string
+	logInfo.setRequest(strings.Join([]string{logInfo.Method, logInfo.Request, logInfo.Protocol}, " "))
+	return logInfo, nil
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const iisSoftware = "Microsoft Internet Information Services"
+
+var (
+	// w3cSetters maps the fields of W3C extended logs, see https://www.w3.org/TR/WD-logfile.html,
+	// the date and time fields are captured in LogInfo.Fields and combined into LogInfo.Time.
+	w3cSetters = map[string]variableSetter{
+		"c-ip":        variableSetters["remote_addr"],
+		"cs-username": variableSetters["remote_user"],
+		"cs-method":   variableSetters["request_method"],
+		"cs-uri-stem": func(info *LogInfo, value string) error {
+			info.Path = unescapeURL(value)
+			return nil
+		},
+		"cs-uri-query": func(info *LogInfo, value string) error {
+			if value != "-" {
+				info.Query = value
+			}
+			return nil
+		},
+		"cs-uri":          variableSetters["request_uri"],
+		"cs-version":      variableSetters["server_protocol"],
+		"cs-host":         variableSetters["host"],
+		"sc-status":       variableSetters["status"],
+		"sc-bytes":        variableSetters["body_bytes_sent"],
+		"cs-bytes":        variableSetters["request_length"],
+		"time-taken":      variableSetters["request_time"],
+		"cs(Referer)":     variableSetters["http_referer"],
+		"cs(User-Agent)":  variableSetters["http_user_agent"],
+		"x-forwarded-for": variableSetters["http_x_forwarded_for"],
+	}
+
+	// iisSetters maps the fields of IIS logs, IIS logs time-taken in milliseconds, and replaces
+	// spaces by "+" in the headers.
+	iisSetters = mergeSetters(w3cSetters, map[string]variableSetter{
+		"time-taken": func(info *LogInfo, value string) (err error) { info.RequestTime, err = msToSeconds(value); return },
+		"cs(Referer)": func(info *LogInfo, value string) error {
+			info.HttpReferer = strings.ReplaceAll(value, "+", " ")
+			return nil
+		},
+		"cs(User-Agent)": func(info *LogInfo, value string) error {
+			info.HttpUserAgent = strings.ReplaceAll(value, "+", " ")
+			return nil
+		},
+	})
+)
+
+type (
+	// W3CParser parses W3C extended logs, whose columns are declared by "#Fields" directives,
+	// the columns are re-mapped whenever a new "#Fields" directive appears, e.g.
+	//   #Software: Microsoft Internet Information Services 10.0
+	//   #Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken
+	//   2021-11-15 05:44:10 10.0.0.4 GET /index.html - 443 - 66.102.6.200 Mozilla/5.0+(X11;+Linux+x86_64) - 200 0 0 203
+	W3CParser struct {
+		name      string
+		separator string // values are separated by spaces or tabs if it is empty
+		defaults  []string
+		setters   map[string]variableSetter
+
+		columns []string
+		date    string // the date of the "#Date" directive, for logs without the date field
+		iis     bool
+	}
+)
+
+func NewW3CParser() *W3CParser {
+	return &W3CParser{name: "w3c", setters: w3cSetters}
+}
+
+func (parser *W3CParser) Reset() {
+	parser.columns, parser.date, parser.iis = parser.defaults, "", false
+}
+
+func (parser *W3CParser) ParseLog(line []byte) (*LogInfo, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, ErrSkipLine
+	}
+	if line[0] == '#' {
+		parser.directive(string(line[1:]))
+		return nil, ErrSkipLine
+	}
+	if parser.columns == nil {
+		return nil, fmt.Errorf("parse %v log error: no #Fields directive", parser.name)
+	}
+
+	var values []string
+	switch {
+	case parser.separator != "":
+		values = strings.Split(string(line), parser.separator)
+	case bytes.IndexByte(line, '\t') >= 0:
+		values = strings.Split(string(line), "\t")
+	default:
+		values = strings.Split(string(line), " ")
+	}
+	if len(values) != len(parser.columns) {
+		return nil, fmt.Errorf("parse %v log error: expected %v fields, got %v", parser.name, len(parser.columns), len(values))
+	}
+
+	setters := parser.setters
+	if parser.iis {
+		setters = iisSetters
+	}
+	logInfo := &LogInfo{}
+	if err := setColumns(logInfo, parser.columns, values, setters); err != nil {
+		return nil, fmt.Errorf("parse %v log error: %v", parser.name, err.Error())
+	}
+	t, err := parser.timestamp(logInfo)
+	if err != nil {
+		return nil, fmt.Errorf("parse %v log error: %v", parser.name, err.Error())
+	}
+	logInfo.Time = t
+	return logInfo, nil
+}
+
+// directive handles the directive without the leading "#", e.g. "Fields: date time c-ip".
+func (parser *W3CParser) directive(directive string) {
+	name, value, _ := strings.Cut(directive, ":")
+	value = strings.TrimSpace(value)
+	switch name {
+	case "Fields":
+		parser.columns = strings.Fields(value)
+	case "Date":
+		parser.date, _, _ = strings.Cut(value, " ")
+	case "Software":
+		parser.iis = strings.HasPrefix(value, iisSoftware)
+	}
+}
+
+// timestamp combines the date and time fields, which are in UTC.
+func (parser *W3CParser) timestamp(info *LogInfo) (t time.Time, err error) {
+	date, ok := info.Fields["date"]
+	if !ok {
+		date = parser.date
+	}
+	clock, ok := info.Fields["time"]
+	if !ok || date == "" {
+		return t, errors.New("no date and time fields")
+	}
+	return timeW3CCache.parse(date + " " + clock)
+}
+
+// mergeSetters returns the union of setters, the latter wins if several setters map the same field.
+func mergeSetters(setters ...map[string]variableSetter) map[string]variableSetter {
+	merged := make(map[string]variableSetter)
+	for _, m := range setters {
+		for name, setter := range m {
+			merged[name] = setter
+		}
+	}
+	return merged
+}
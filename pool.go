@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/fantasticmao/nginx-log-analyzer/handler"
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+)
+
+// batchSize is the maximum number of lines sent to the workers at a time.
+const batchSize = 1024
+
+type (
+	// line is a line of a log file, its line number and its offset in the content.
+	line struct {
+		no     int
+		offset int64
+		data   []byte
+	}
+
+	// lineBatch is the lines of a log file, which are parsed by a worker together.
+	lineBatch struct {
+		logFile string
+		parser  parser.Parser
+		lines   []line
+		// set when a line is past the end time by more than the tolerance
+		past *atomic.Bool
+		wg   *sync.WaitGroup
+	}
+
+	// workerPool is a fixed number of workers, which parse the batches of lines and hand the
+	// parsed LogInfo of each batch to the handler at once.
+	workerPool struct {
+		loganalyzer *loganalyzer
+		batches     chan *lineBatch
+		wg          sync.WaitGroup
+	}
+
+	// batcher collects the lines of a log file into batches, and sends them to the workers.
+	batcher struct {
+		pool    *workerPool
+		logFile string
+		parser  parser.Parser
+		past    *atomic.Bool
+		batch   []line
+		wg      sync.WaitGroup
+	}
+)
+
+func newWorkerPool(loganalyzer *loganalyzer, workers int) *workerPool {
+	pool := &workerPool{
+		loganalyzer: loganalyzer,
+		// the lines read ahead of the workers are bounded
+		batches: make(chan *lineBatch, workers),
+	}
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+	return pool
+}
+
+func (pool *workerPool) work() {
+	defer pool.wg.Done()
+	infos := make([]*parser.LogInfo, 0, batchSize)
+	for batch := range pool.batches {
+		infos = infos[:0]
+		for _, l := range batch.lines {
+			// 2. parse line, 3. datetime filter
+			logInfo, _, past := parseLine(pool.loganalyzer, batch.parser, batch.logFile, l.no, l.offset, l.data)
+			if past {
+				batch.past.Store(true)
+			}
+			if logInfo != nil {
+				infos = append(infos, logInfo)
+			}
+		}
+		// 4. process data
+		if h, ok := pool.loganalyzer.handler.(handler.BatchHandler); ok {
+			h.InputBatch(infos)
+		} else {
+			for _, logInfo := range infos {
+				pool.loganalyzer.handler.Input(logInfo)
+			}
+		}
+		batch.wg.Done()
+	}
+}
+
+// close stops the workers after the sent batches are handled.
+func (pool *workerPool) close() {
+	close(pool.batches)
+	pool.wg.Wait()
+}
+
+// batcher returns a batcher of the log file, past is set when a line of the log file is past
+// the end time by more than the tolerance.
+func (pool *workerPool) batcher(logFile string, logParser parser.Parser, past *atomic.Bool) *batcher {
+	return &batcher{
+		pool:    pool,
+		logFile: logFile,
+		parser:  logParser,
+		past:    past,
+	}
+}
+
+func (b *batcher) add(lineNo int, offset int64, data []byte) {
+	if b.batch == nil {
+		b.batch = make([]line, 0, batchSize)
+	}
+	b.batch = append(b.batch, line{no: lineNo, offset: offset, data: data})
+	if len(b.batch) == batchSize {
+		b.flush()
+	}
+}
+
+func (b *batcher) flush() {
+	if len(b.batch) == 0 {
+		return
+	}
+	b.wg.Add(1)
+	b.pool.batches <- &lineBatch{
+		logFile: b.logFile,
+		parser:  b.parser,
+		lines:   b.batch,
+		past:    b.past,
+		wg:      &b.wg,
+	}
+	b.batch = nil
+}
+
+// wait sends the rest lines, and waits for the lines to be handled.
+func (b *batcher) wait() {
+	b.flush()
+	b.wg.Wait()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fantasticmao/nginx-log-analyzer/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordHandler records the batches of LogInfo it inputs.
+type recordHandler struct {
+	batches [][]*parser.LogInfo
+	mu      sync.Mutex
+}
+
+func (h *recordHandler) Input(info *parser.LogInfo) {
+	h.InputBatch([]*parser.LogInfo{info})
+}
+
+func (h *recordHandler) InputBatch(infos []*parser.LogInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.batches = append(h.batches, append([]*parser.LogInfo(nil), infos...))
+}
+
+func (h *recordHandler) Output(limit int) {
+}
+
+// numberParser parses the lines of numbers, the numbers are the paths of LogInfo.
+type numberParser struct{}
+
+func (numberParser) ParseLog(line []byte) (*parser.LogInfo, error) {
+	s := string(line[:len(line)-1])
+	if _, err := strconv.Atoi(s); err != nil {
+		return nil, err
+	}
+	return &parser.LogInfo{Path: s}, nil
+}
+
+func TestWorkerPool(t *testing.T) {
+	for _, n := range []int{1, 4} {
+		h := &recordHandler{}
+		loganalyzer := &loganalyzer{handler: h, rejecter: newRejecter(onErrorSkip, "")}
+		pool := newWorkerPool(loganalyzer, n)
+
+		var past atomic.Bool
+		b := pool.batcher("numbers", numberParser{}, &past)
+		lines := 2*batchSize + 10
+		for i := 0; i < lines; i++ {
+			b.add(i+1, int64(i), []byte(strconv.Itoa(i)+"\n"))
+		}
+		b.add(lines+1, int64(lines), []byte("x\n"))
+		// the full batches are sent, and the rest lines are sent by wait
+		b.wait()
+		assert.Equal(t, 3, len(h.batches))
+
+		// the lines of each batch are handled in order, and every line once
+		seen := make(map[string]bool)
+		for _, batch := range h.batches {
+			for j, info := range batch {
+				seen[info.Path] = true
+				if j > 0 {
+					prev, _ := strconv.Atoi(batch[j-1].Path)
+					cur, _ := strconv.Atoi(info.Path)
+					assert.Equal(t, prev+1, cur)
+				}
+			}
+		}
+		assert.Equal(t, lines, len(seen))
+		if n == 1 {
+			// a single worker handles the batches in the order they are sent
+			assert.Equal(t, "0", h.batches[0][0].Path)
+			assert.Equal(t, strconv.Itoa(batchSize), h.batches[1][0].Path)
+			assert.Equal(t, 10, len(h.batches[2]))
+		}
+		assert.False(t, past.Load())
+		assert.Equal(t, 1, loganalyzer.rejecter.counts["numbers"])
+		pool.close()
+	}
+
+	// nothing is sent for no lines
+	h := &recordHandler{}
+	pool := newWorkerPool(&loganalyzer{handler: h}, 2)
+	pool.batcher("empty", numberParser{}, nil).wait()
+	pool.close()
+	assert.Equal(t, 0, len(h.batches))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/fantasticmao/nginx-log-analyzer/ioutil"
+)
+
+const (
+	onErrorFail       = "fail"
+	onErrorSkip       = "skip"
+	onErrorQuarantine = "quarantine"
+)
+
+// rejecter handles the lines which could not be parsed, according to the -on-error policy.
+type rejecter struct {
+	policy     string
+	file       *os.File
+	quarantine *bufio.Writer
+	counts     map[string]int // log file -> rejected lines
+	mu         sync.Mutex
+}
+
+func newRejecter(policy, quarantineFile string) *rejecter {
+	r := &rejecter{
+		policy: policy,
+		counts: make(map[string]int),
+	}
+	switch policy {
+	case onErrorFail, onErrorSkip:
+	case onErrorQuarantine:
+		file, err := os.Create(quarantineFile)
+		if err != nil {
+			ioutil.Fatal("create quarantine file error: %v\n", err.Error())
+			return nil
+		}
+		r.file = file
+		r.quarantine = bufio.NewWriter(file)
+	default:
+		ioutil.Fatal("unsupported on-error policy: %v\n", policy)
+		return nil
+	}
+	return r
+}
+
+// reject handles the line of the log file, the line number is counted from where the file is
+// read, e.g. the offset of -ta or -incremental, and the offset is in the content of the file.
+func (r *rejecter) reject(logFile string, lineNo int, offset int64, line []byte, err error) {
+	if r.policy == onErrorFail {
+		ioutil.Fatal("%v:%v (offset %v): %v\n", logFile, lineNo, offset, err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[logFile]++
+	if r.quarantine != nil {
+		_, _ = fmt.Fprintf(r.quarantine, "%v:%v (offset %v): %s", logFile, lineNo, offset, line)
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			_ = r.quarantine.WriteByte('\n')
+		}
+	}
+}
+
+// close flushes the quarantine file, and prints the summary of rejected lines.
+func (r *rejecter) close(w io.Writer) {
+	if r.quarantine != nil {
+		if err := r.quarantine.Flush(); err != nil {
+			ioutil.Fatal("write quarantine file error: %v\n", err.Error())
+			return
+		}
+		if err := r.file.Close(); err != nil {
+			ioutil.Fatal("close quarantine file error: %v\n", err.Error())
+			return
+		}
+	}
+
+	if len(r.counts) == 0 {
+		return
+	}
+	logFiles := make([]string, 0, len(r.counts))
+	total := 0
+	for logFile, count := range r.counts {
+		logFiles = append(logFiles, logFile)
+		total += count
+	}
+	sort.Strings(logFiles)
+
+	_, _ = fmt.Fprintf(w, "rejected %v lines\n", total)
+	for _, logFile := range logFiles {
+		_, _ = fmt.Fprintf(w, "  |--\"%v\" rejected: %v\n", logFile, r.counts[logFile])
+	}
+	if r.quarantine != nil {
+		_, _ = fmt.Fprintf(w, "rejected lines are written to %v\n", r.file.Name())
+	}
+}
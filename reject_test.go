@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejecter(t *testing.T) {
+	quarantineFile := filepath.Join(t.TempDir(), "rejected.log")
+	r := newRejecter(onErrorQuarantine, quarantineFile)
+	r.reject("b.log", 3, 20, []byte("bad line\n"), errors.New("bad"))
+	r.reject("a.log", 1, 0, []byte("truncated"), errors.New("bad"))
+	r.reject("b.log", 7, 1024, []byte("another bad line\n"), errors.New("bad"))
+
+	var summary bytes.Buffer
+	r.close(&summary)
+	assert.Equal(t, "rejected 3 lines\n"+
+		"  |--\"a.log\" rejected: 1\n"+
+		"  |--\"b.log\" rejected: 2\n"+
+		"rejected lines are written to "+quarantineFile+"\n", summary.String())
+	data, err := os.ReadFile(quarantineFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "b.log:3 (offset 20): bad line\n"+
+		"a.log:1 (offset 0): truncated\n"+
+		"b.log:7 (offset 1024): another bad line\n", string(data))
+
+	// the skipped lines are counted only
+	r = newRejecter(onErrorSkip, "")
+	r.reject("a.log", 2, 10, []byte("bad line\n"), errors.New("bad"))
+	summary.Reset()
+	r.close(&summary)
+	assert.Equal(t, "rejected 1 lines\n  |--\"a.log\" rejected: 1\n", summary.String())
+
+	// nothing is printed without rejected lines
+	summary.Reset()
+	newRejecter(onErrorSkip, "").close(&summary)
+	assert.Equal(t, "", summary.String())
+}
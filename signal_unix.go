@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// renderSignals are the signals which re-render the output in '-f' mode.
+var renderSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// renderSignals are the signals which re-render the output in '-f' mode, there is no
+// SIGUSR1 on Windows.
+var renderSignals []os.Signal